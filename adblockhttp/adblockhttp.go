@@ -0,0 +1,148 @@
+// Package adblockhttp blocks HTTP requests matching the rules of a RuleSet,
+// as an http.RoundTripper for clients or as a forward proxy
+package adblockhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/simonfrey/adblockgoparser"
+)
+
+// Rules decides whether requests are blocked,
+// *adblockgoparser.RuleSet and *adblockgoparser.AtomicRuleSet implement it
+type Rules interface {
+	Match(req *adblockgoparser.Request) *adblockgoparser.MatchResult
+	MatchHostname(hostname string, client string) *adblockgoparser.MatchResult
+	RemoveParams(req *adblockgoparser.Request) *url.URL
+	ContentSecurityPolicies(req *adblockgoparser.Request) []string
+}
+
+// Responder builds the response answering a blocked request
+type Responder func(req *http.Request, result *adblockgoparser.MatchResult) *http.Response
+
+// Resource types by the value of the Sec-Fetch-Dest header
+var fetchDestTypes = map[string]adblockgoparser.ResourceType{
+	"document":      adblockgoparser.TypeDocument,
+	"iframe":        adblockgoparser.TypeSubdocument,
+	"frame":         adblockgoparser.TypeSubdocument,
+	"script":        adblockgoparser.TypeScript,
+	"worker":        adblockgoparser.TypeScript,
+	"sharedworker":  adblockgoparser.TypeScript,
+	"serviceworker": adblockgoparser.TypeScript,
+	"audioworklet":  adblockgoparser.TypeScript,
+	"paintworklet":  adblockgoparser.TypeScript,
+	"image":         adblockgoparser.TypeImage,
+	"style":         adblockgoparser.TypeStylesheet,
+	"xslt":          adblockgoparser.TypeStylesheet,
+	"font":          adblockgoparser.TypeFont,
+	"object":        adblockgoparser.TypeObject,
+	"embed":         adblockgoparser.TypeObject,
+	"audio":         adblockgoparser.TypeMedia,
+	"video":         adblockgoparser.TypeMedia,
+	"track":         adblockgoparser.TypeMedia,
+	"report":        adblockgoparser.TypePing,
+}
+
+// NewRequest Creates the Request matched against the rules from an outgoing or proxied HTTP request.
+// The resource type comes from the Sec-Fetch-Dest header, and is guessed from the URL when the client didn't send it.
+func NewRequest(r *http.Request) *adblockgoparser.Request {
+	req := &adblockgoparser.Request{
+		URL:     requestURL(r),
+		Origin:  r.Header.Get("Origin"),
+		Referer: r.Header.Get("Referer"),
+		IsXHR:   strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest"),
+	}
+
+	dest := strings.ToLower(r.Header.Get("Sec-Fetch-Dest"))
+	switch {
+	case strings.EqualFold(r.Header.Get("Upgrade"), "websocket"):
+		req.ResourceType = adblockgoparser.TypeWebsocket
+	case r.Header.Get("Ping-To") != "":
+		req.ResourceType = adblockgoparser.TypePing
+	case dest == "empty":
+		// fetch() and XMLHttpRequest
+		req.IsXHR = true
+	default:
+		req.ResourceType = fetchDestTypes[dest]
+	}
+
+	// Subresources are usually made for the page in their Referer, documents are their own page
+	if req.ResourceType != adblockgoparser.TypeDocument {
+		if page, err := url.Parse(req.Referer); err == nil && page.IsAbs() {
+			req.PageURL = page
+		}
+	}
+	return req
+}
+
+// requestURL returns the absolute URL of the request, server side requests only have the path in their URL
+func requestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	return &u
+}
+
+// Forbidden answers blocked requests with an empty 403 Forbidden response
+func Forbidden(req *http.Request, result *adblockgoparser.MatchResult) *http.Response {
+	return newResponse(req, http.StatusForbidden, nil)
+}
+
+// NoContent answers blocked requests with an empty 204 No Content response,
+// pages usually handle it better than an error
+func NoContent(req *http.Request, result *adblockgoparser.MatchResult) *http.Response {
+	return newResponse(req, http.StatusNoContent, nil)
+}
+
+// Redirect returns a Responder redirecting blocked requests to location, ie: a neutered resource
+func Redirect(location string) Responder {
+	return func(req *http.Request, result *adblockgoparser.MatchResult) *http.Response {
+		resp := newResponse(req, http.StatusTemporaryRedirect, nil)
+		resp.Header.Set("Location", location)
+		return resp
+	}
+}
+
+// Resource returns a Responder serving the bundled resource the redirect rules chose for the blocked request,
+// the requests without redirect are answered by fallback, Forbidden when nil
+func Resource(fallback Responder) Responder {
+	if fallback == nil {
+		fallback = Forbidden
+	}
+	return func(req *http.Request, result *adblockgoparser.MatchResult) *http.Response {
+		resource, ok := adblockgoparser.LookupResource(result.Redirect)
+		if !ok {
+			return fallback(req, result)
+		}
+		resp := newResponse(req, http.StatusOK, resource.Body)
+		resp.Header.Set("Content-Type", resource.ContentType)
+		return resp
+	}
+}
+
+// newResponse creates a response to the request with the body
+func newResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
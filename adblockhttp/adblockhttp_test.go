@@ -0,0 +1,188 @@
+package adblockhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/simonfrey/adblockgoparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRuleSet(t *testing.T, rules ...string) *adblockgoparser.RuleSet {
+	ruleSet, _, err := adblockgoparser.NewRuleSetFromReader(strings.NewReader(strings.Join(rules, "\n")))
+	assert.NoError(t, err)
+	return ruleSet
+}
+
+func TestNewRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://ads.example.com/pixel", nil)
+	r.Header.Set("Referer", "https://news.com/")
+	r.Header.Set("Sec-Fetch-Dest", "image")
+	req := NewRequest(r)
+	assert.Equal(t, "http://ads.example.com/pixel", req.URL.String())
+	assert.Equal(t, "https://news.com/", req.Referer)
+	assert.Equal(t, adblockgoparser.TypeImage, req.ResourceType)
+	assert.False(t, req.IsXHR)
+	assert.Equal(t, "https://news.com/", req.PageURL.String())
+
+	r = httptest.NewRequest("GET", "http://example.com/", nil)
+	r.Header.Set("Referer", "https://search.com/")
+	r.Header.Set("Sec-Fetch-Dest", "document")
+	assert.Nil(t, NewRequest(r).PageURL)
+
+	r = httptest.NewRequest("POST", "/api", nil)
+	r.Host = "api.example.com"
+	r.Header.Set("Origin", "https://news.com")
+	r.Header.Set("Sec-Fetch-Dest", "empty")
+	req = NewRequest(r)
+	assert.Equal(t, "http://api.example.com/api", req.URL.String())
+	assert.Equal(t, "https://news.com", req.Origin)
+	assert.Equal(t, adblockgoparser.TypeUnknown, req.ResourceType)
+	assert.True(t, req.IsXHR)
+
+	r = httptest.NewRequest("GET", "http://example.com/socket", nil)
+	r.Header.Set("Upgrade", "websocket")
+	assert.Equal(t, adblockgoparser.TypeWebsocket, NewRequest(r).ResourceType)
+
+	r = httptest.NewRequest("GET", "http://example.com/lib.js", nil)
+	r.Header.Set("X-Requested-With", "XMLHttpRequest")
+	assert.True(t, NewRequest(r).IsXHR)
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content" + r.URL.RawQuery))
+	}))
+	defer upstream.Close()
+	host, _ := url.Parse(upstream.URL)
+
+	ruleSet := newRuleSet(t, "/ads/*", "/tracker.js$script", "$removeparam=fbclid")
+	client := &http.Client{Transport: NewTransport(ruleSet, nil, nil)}
+
+	resp, err := client.Get(upstream.URL + "/page")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "content", string(body))
+
+	resp, err = client.Get(upstream.URL + "/ads/banner.gif")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = client.Get(upstream.URL + "/page?id=1&fbclid=abc")
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "contentid=1", string(body))
+
+	// The script option only blocks requests for scripts
+	req, _ := http.NewRequest("GET", "http://"+host.Host+"/tracker.js", nil)
+	req.Header.Set("Sec-Fetch-Dest", "image")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	client = &http.Client{Transport: NewTransport(ruleSet, nil, NoContent)}
+	resp, err = client.Get(upstream.URL + "/ads/banner.gif")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	transport := NewTransport(newRuleSet(t, "||example.com^$image,redirect=1x1.gif", "/x.js"), nil, Resource(NoContent))
+	resp, err = transport.RoundTrip(httptest.NewRequest("GET", "http://example.com/p.gif", nil))
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/gif", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "GIF89a", string(body[:6]))
+	resp, err = transport.RoundTrip(httptest.NewRequest("GET", "http://example.com/x.js", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	transport = NewTransport(ruleSet, nil, Redirect("http://localhost/blank.gif"))
+	resp, err = transport.RoundTrip(httptest.NewRequest("GET", upstream.URL+"/ads/banner.gif", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "http://localhost/blank.gif", resp.Header.Get("Location"))
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		if strings.HasSuffix(r.URL.Path, ".html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		w.Write([]byte("content " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	ruleSet := newRuleSet(t, "/ads/*", "||blocked.example.com^", "$csp=worker-src 'none'")
+	proxy := httptest.NewServer(NewProxy(ruleSet, nil, nil))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(upstream.URL + "/page")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "content /page", string(body))
+	assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+	assert.Empty(t, resp.Header.Get("Content-Security-Policy"))
+
+	resp, err = client.Get(upstream.URL + "/index.html")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "worker-src 'none'", resp.Header.Get("Content-Security-Policy"))
+
+	resp, err = client.Get(upstream.URL + "/ads/banner.gif")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// HTTPS requests are checked by hostname when they open the tunnel
+	secure := httptest.NewTLSServer(upstream.Config.Handler)
+	defer secure.Close()
+	tlsTransport := secure.Client().Transport.(*http.Transport)
+	tlsTransport.Proxy = http.ProxyURL(proxyURL)
+	resp, err = secure.Client().Get(secure.URL + "/secure")
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "content /secure", string(body))
+
+	_, err = client.Get("https://blocked.example.com/")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Forbidden")
+
+	w := httptest.NewRecorder()
+	NewProxy(ruleSet, nil, nil).ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProxyWebsocket(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	proxy := NewProxy(newRuleSet(t, "/live/*$websocket"), nil, nil)
+
+	// Upgrade is a hop-by-hop header, the rules are checked before it is removed
+	r := httptest.NewRequest("GET", upstream.URL+"/live/feed", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", upstream.URL+"/live/feed", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "content /live/feed", w.Body.String())
+}
@@ -0,0 +1,148 @@
+package adblockhttp
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simonfrey/adblockgoparser"
+)
+
+// Hop-by-hop headers, they are not forwarded by proxies
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is an HTTP forward proxy blocking the requests matching its rules
+// and adding the Content-Security-Policy of csp rules to HTML documents.
+// HTTPS requests are tunneled with CONNECT, only their hostname can be checked.
+type Proxy struct {
+	rules     Rules
+	transport *Transport
+	dialer    net.Dialer
+}
+
+// NewProxy Creates a Proxy forwarding requests through base, http.DefaultTransport when nil,
+// and answering blocked requests with respond, Forbidden when nil
+func NewProxy(rules Rules, base http.RoundTripper, respond Responder) *Proxy {
+	return &Proxy{
+		rules:     rules,
+		transport: NewTransport(rules, base, respond),
+		dialer:    net.Dialer{Timeout: 30 * time.Second},
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "Not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	// The request is described before hop-by-hop headers like Upgrade are removed
+	request := NewRequest(r)
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	if out.ContentLength == 0 {
+		out.Body = nil
+	}
+	removeHopHeaders(out.Header)
+	resp, err := p.transport.roundTrip(out, request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		for _, policy := range p.rules.ContentSecurityPolicies(request) {
+			resp.Header.Add("Content-Security-Policy", policy)
+		}
+	}
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects the client to the requested host unless a DNS level rule blocks the hostname
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if result := p.rules.MatchHostname(host, ""); result.Verdict == adblockgoparser.Blocked {
+		http.Error(w, "Blocked", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, buffered)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(client, upstream)
+		closeWrite(client)
+	}()
+	wg.Wait()
+	upstream.Close()
+	client.Close()
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, field := range strings.Split(header.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			header.Del(field)
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// closeWrite tells the other end no more data is coming, when the connection supports it
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+}
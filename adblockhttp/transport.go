@@ -0,0 +1,52 @@
+package adblockhttp
+
+import (
+	"net/http"
+
+	"github.com/simonfrey/adblockgoparser"
+)
+
+// Transport is an http.RoundTripper answering the blocked requests itself
+// and sending the other ones through its base RoundTripper
+type Transport struct {
+	rules   Rules
+	base    http.RoundTripper
+	respond Responder
+}
+
+// NewTransport Creates a Transport blocking the requests matching rules.
+// A nil base uses http.DefaultTransport and a nil respond answers with Forbidden.
+func NewTransport(rules Rules, base http.RoundTripper, respond Responder) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if respond == nil {
+		respond = Forbidden
+	}
+	return &Transport{
+		rules:   rules,
+		base:    base,
+		respond: respond,
+	}
+}
+
+// RoundTrip implements http.RoundTripper, the allowed requests are sent without
+// the query parameters removed by removeparam rules
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTrip(req, NewRequest(req))
+}
+
+// roundTrip sends req unless request, the filter Request describing it, is blocked
+func (t *Transport) roundTrip(req *http.Request, request *adblockgoparser.Request) (*http.Response, error) {
+	if result := t.rules.Match(request); result.Verdict == adblockgoparser.Blocked {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return t.respond(req, result), nil
+	}
+	if cleaned := t.rules.RemoveParams(request); cleaned != request.URL {
+		req = req.Clone(req.Context())
+		req.URL.RawQuery = cleaned.RawQuery
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,92 @@
+package adblockgoparser
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicRuleSet holds a RuleSet that can be replaced while other goroutines match requests against it.
+// Calls in flight finish on the RuleSet they started with, later calls see the new one.
+type AtomicRuleSet struct {
+	current atomic.Value
+	// reload serializes the calls to Reload
+	reload sync.Mutex
+}
+
+// NewAtomicRuleSet Creates an AtomicRuleSet serving the given RuleSet, or an empty one if nil
+func NewAtomicRuleSet(ruleSet *RuleSet) *AtomicRuleSet {
+	atomicRuleSet := &AtomicRuleSet{}
+	atomicRuleSet.Store(ruleSet)
+	return atomicRuleSet
+}
+
+// Load returns the RuleSet currently served. It must not be modified.
+func (a *AtomicRuleSet) Load() *RuleSet {
+	ruleSet, _ := a.current.Load().(*RuleSet)
+	if ruleSet == nil {
+		return CreateRuleSet()
+	}
+	return ruleSet
+}
+
+// Store swaps the served RuleSet. The RuleSet must not be modified after being stored.
+func (a *AtomicRuleSet) Store(ruleSet *RuleSet) {
+	if ruleSet == nil {
+		ruleSet = CreateRuleSet()
+	}
+	a.current.Store(ruleSet)
+}
+
+// Reload builds a new RuleSet and swaps it in. On error the current RuleSet keeps being served.
+func (a *AtomicRuleSet) Reload(build func() (*RuleSet, error)) error {
+	a.reload.Lock()
+	defer a.reload.Unlock()
+
+	ruleSet, err := build()
+	if err != nil {
+		return err
+	}
+	a.Store(ruleSet)
+	return nil
+}
+
+// Match the request against the current RuleSet
+func (a *AtomicRuleSet) Match(req *Request) *MatchResult {
+	return a.Load().Match(req)
+}
+
+// Allow return of the current request is allowed to proceed according to the current RuleSet
+func (a *AtomicRuleSet) Allow(req *Request) bool {
+	return a.Load().Allow(req)
+}
+
+// CosmeticRulesForPage returns the element hiding rules of the current RuleSet applying on the page
+func (a *AtomicRuleSet) CosmeticRulesForPage(page *Request) []*CosmeticRule {
+	return a.Load().CosmeticRulesForPage(page)
+}
+
+// Scriptlets returns the scriptlets of the current RuleSet to inject in the pages of the hostname
+func (a *AtomicRuleSet) Scriptlets(hostname string) []*ScriptletRule {
+	return a.Load().Scriptlets(hostname)
+}
+
+// MatchHostname return the decision of the current RuleSet for a DNS query of the hostname made by the client
+func (a *AtomicRuleSet) MatchHostname(hostname string, client string) *MatchResult {
+	return a.Load().MatchHostname(hostname, client)
+}
+
+// AllowHostname return if the current RuleSet answers DNS queries of the hostname
+func (a *AtomicRuleSet) AllowHostname(hostname string) bool {
+	return a.Load().AllowHostname(hostname)
+}
+
+// RemoveParams returns the URL of the request without the query parameters the current RuleSet removes
+func (a *AtomicRuleSet) RemoveParams(req *Request) *url.URL {
+	return a.Load().RemoveParams(req)
+}
+
+// ContentSecurityPolicies returns the Content-Security-Policy values the current RuleSet adds to the document
+func (a *AtomicRuleSet) ContentSecurityPolicies(req *Request) []string {
+	return a.Load().ContentSecurityPolicies(req)
+}
@@ -0,0 +1,54 @@
+package adblockgoparser
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicRuleSetReload(t *testing.T) {
+	atomicRuleSet := NewAtomicRuleSet(nil)
+	assert.True(t, atomicRuleSet.Allow(reqFromURL("http://ads.example.com/")))
+
+	err := atomicRuleSet.Reload(func() (*RuleSet, error) {
+		ruleSet, _, err := NewRuleSetFromReader(strings.NewReader("||ads.example.com^"))
+		return ruleSet, err
+	})
+	assert.NoError(t, err)
+	assert.False(t, atomicRuleSet.Allow(reqFromURL("http://ads.example.com/")))
+
+	// A failing reload keeps the current rules
+	err = atomicRuleSet.Reload(func() (*RuleSet, error) {
+		return nil, errors.New("download failed")
+	})
+	assert.EqualError(t, err, "download failed")
+	assert.Equal(t, Blocked, atomicRuleSet.Match(reqFromURL("http://ads.example.com/")).Verdict)
+}
+
+func TestAtomicRuleSetConcurrentReload(t *testing.T) {
+	lists := []string{"||ads.example.com^", "||ads.example.com^\n@@||ads.example.com^$script"}
+	atomicRuleSet := NewAtomicRuleSet(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				atomicRuleSet.Allow(reqFromURL("http://ads.example.com/file.js"))
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		list := lists[i%len(lists)]
+		assert.NoError(t, atomicRuleSet.Reload(func() (*RuleSet, error) {
+			ruleSet, _, err := NewRuleSetFromReader(strings.NewReader(list))
+			return ruleSet, err
+		}))
+	}
+	wg.Wait()
+	assert.True(t, atomicRuleSet.Allow(reqFromURL("http://ads.example.com/file.js")))
+}
@@ -0,0 +1,389 @@
+// Command adblockcheck tells whether URLs are blocked by filter lists and which rule decided it.
+//
+// Check URLs given as arguments, or read one per line from stdin:
+//
+//	adblockcheck -list easylist.txt -list hosts:hosts.txt -type script https://ads.example.com/ad.js
+//
+// Summarize the requests recorded in a HAR file or an access log:
+//
+//	adblockcheck -list easylist.txt -har session.har
+//	adblockcheck -list easylist.txt -log access.log -base https://example.com
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/simonfrey/adblockgoparser"
+)
+
+// listFlags collects the repeated -list flags
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns its exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("adblockcheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var lists listFlags
+	flags.Var(&lists, "list", "filter list `file` to load, can be repeated. Prefix with \"hosts:\" for hosts files and domain lists")
+	typeName := flags.String("type", "", "resource `type` of the requests, ie: script, image, document")
+	referer := flags.String("referer", "", "`URL` of the page making the requests")
+	page := flags.String("page", "", "`URL` of the page the requests are made for, checked by $document and $genericblock exceptions")
+	xhr := flags.Bool("xhr", false, "the requests are made with XMLHttpRequest or fetch")
+	harFile := flags.String("har", "", "summarize the requests of a HAR `file`")
+	logFile := flags.String("log", "", "summarize the requests of an access log `file`, in Apache/nginx combined format or with absolute URLs")
+	base := flags.String("base", "", "base `URL` of the relative request targets of the access log, ie: https://example.com, their lines are skipped without it")
+	verbose := flags.Bool("v", false, "print the lines of the lists that couldn't be loaded")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(lists) == 0 {
+		fmt.Fprintln(stderr, "At least one -list is required")
+		flags.Usage()
+		return 2
+	}
+
+	resourceType := adblockgoparser.TypeUnknown
+	if *typeName != "" {
+		var ok bool
+		if resourceType, ok = adblockgoparser.ParseResourceType(*typeName); !ok {
+			fmt.Fprintf(stderr, "Unknown resource type %q\n", *typeName)
+			return 2
+		}
+	}
+
+	var pageURL *url.URL
+	if *page != "" {
+		var err error
+		if pageURL, err = url.Parse(*page); err != nil || !pageURL.IsAbs() {
+			fmt.Fprintf(stderr, "Invalid page URL %q\n", *page)
+			return 2
+		}
+	}
+
+	ruleSet, err := loadLists(lists, stderr, *verbose)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	switch {
+	case *harFile != "":
+		requests, err := readHAR(*harFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		summarize(stdout, ruleSet, requests)
+	case *logFile != "":
+		var baseURL *url.URL
+		if *base != "" {
+			if baseURL, err = url.Parse(*base); err != nil || !baseURL.IsAbs() {
+				fmt.Fprintf(stderr, "Invalid base URL %q\n", *base)
+				return 2
+			}
+		}
+		requests, err := readLog(*logFile, baseURL)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		summarize(stdout, ruleSet, requests)
+	default:
+		urls := flags.Args()
+		if len(urls) == 0 {
+			scanner := bufio.NewScanner(stdin)
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					urls = append(urls, line)
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+		}
+		status := 0
+		for _, rawURL := range urls {
+			u, err := url.Parse(rawURL)
+			if err != nil || !u.IsAbs() {
+				fmt.Fprintf(stderr, "Invalid URL %q\n", rawURL)
+				status = 1
+				continue
+			}
+			check(stdout, ruleSet, &adblockgoparser.Request{
+				URL:          u,
+				Referer:      *referer,
+				IsXHR:        *xhr,
+				ResourceType: resourceType,
+				PageURL:      pageURL,
+			})
+		}
+		return status
+	}
+	return 0
+}
+
+// loadLists loads every list in a RuleSet, named after their file
+func loadLists(lists []string, stderr io.Writer, verbose bool) (*adblockgoparser.RuleSet, error) {
+	ruleSet := adblockgoparser.CreateRuleSet()
+	for _, list := range lists {
+		name := strings.TrimPrefix(list, "hosts:")
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		var report *adblockgoparser.ListReport
+		if strings.HasPrefix(list, "hosts:") {
+			report, err = ruleSet.AddHostsList(name, f)
+		} else {
+			report, err = ruleSet.AddList(name, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if verbose {
+			for _, skipped := range report.Skipped {
+				fmt.Fprintf(stderr, "%s:%d: %v: %s\n", name, skipped.Line, skipped.Err, skipped.Text)
+			}
+			options := make([]string, 0, len(report.UnsupportedOptions))
+			for option := range report.UnsupportedOptions {
+				options = append(options, option)
+			}
+			sort.Strings(options)
+			for _, option := range options {
+				fmt.Fprintf(stderr, "%s: %d rules skipped for unsupported option %q\n", name, report.UnsupportedOptions[option], option)
+			}
+		}
+	}
+	return ruleSet, nil
+}
+
+// check prints the verdict for the request, followed by the rules that decided it
+func check(w io.Writer, ruleSet *adblockgoparser.RuleSet, req *adblockgoparser.Request) {
+	result := ruleSet.Match(req)
+	switch {
+	case result.Verdict == adblockgoparser.Blocked && result.Redirect != "":
+		fmt.Fprintf(w, "blocked\t%s\t%s\tredirect to %s\n", req.URL, describe(result.Rule), result.Redirect)
+	case result.Verdict == adblockgoparser.Blocked:
+		fmt.Fprintf(w, "blocked\t%s\t%s\n", req.URL, describe(result.Rule))
+	case result.Verdict == adblockgoparser.AllowedByException:
+		fmt.Fprintf(w, "allowed\t%s\t%s\texception to %s\n", req.URL, describe(result.Exception), describe(result.Rule))
+	default:
+		fmt.Fprintf(w, "nomatch\t%s\n", req.URL)
+	}
+}
+
+// describe returns the rule as written and where it comes from, ie: "||ads.example.com^ (easylist.txt:42)"
+func describe(rule *adblockgoparser.RuleAdBlock) string {
+	return fmt.Sprintf("%s (%s:%d)", rule.Raw, rule.Source, rule.Line)
+}
+
+// summarize prints how many requests each verdict got and the rules deciding the most of them
+func summarize(w io.Writer, ruleSet *adblockgoparser.RuleSet, requests []*adblockgoparser.Request) {
+	verdicts := map[adblockgoparser.Verdict]int{}
+	hits := map[*adblockgoparser.RuleAdBlock]int{}
+	for _, req := range requests {
+		result := ruleSet.Match(req)
+		verdicts[result.Verdict]++
+		switch result.Verdict {
+		case adblockgoparser.Blocked:
+			hits[result.Rule]++
+		case adblockgoparser.AllowedByException:
+			hits[result.Exception]++
+		}
+	}
+
+	fmt.Fprintf(w, "requests\t%d\n", len(requests))
+	fmt.Fprintf(w, "blocked\t%d\n", verdicts[adblockgoparser.Blocked])
+	fmt.Fprintf(w, "allowed\t%d\n", verdicts[adblockgoparser.AllowedByException])
+	fmt.Fprintf(w, "nomatch\t%d\n", verdicts[adblockgoparser.NoMatch])
+
+	rules := make([]*adblockgoparser.RuleAdBlock, 0, len(hits))
+	for rule := range hits {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if hits[rules[i]] != hits[rules[j]] {
+			return hits[rules[i]] > hits[rules[j]]
+		}
+		return describe(rules[i]) < describe(rules[j])
+	})
+	if len(rules) > 10 {
+		rules = rules[:10]
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%d\t%s\n", hits[rule], describe(rule))
+	}
+}
+
+// har is the part of the HAR format describing requests
+type har struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"request"`
+			// Set by Chrome
+			ResourceType string `json:"_resourceType"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// readHAR returns the requests recorded in a HAR file
+func readHAR(name string) ([]*adblockgoparser.Request, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var archive har
+	if err := json.NewDecoder(f).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("Cannot read HAR file %q: %w", name, err)
+	}
+	if archive.Log.Entries == nil {
+		return nil, errors.New("No entries in HAR file " + name)
+	}
+
+	requests := []*adblockgoparser.Request{}
+	for _, entry := range archive.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil || !u.IsAbs() {
+			continue
+		}
+		req := &adblockgoparser.Request{URL: u}
+		for _, header := range entry.Request.Headers {
+			switch strings.ToLower(header.Name) {
+			case "referer":
+				req.Referer = header.Value
+			case "origin":
+				req.Origin = header.Value
+			case "x-requested-with":
+				req.IsXHR = strings.EqualFold(header.Value, "XMLHttpRequest")
+			}
+		}
+		switch entry.ResourceType {
+		case "xhr", "fetch":
+			req.IsXHR = true
+		default:
+			req.ResourceType, _ = adblockgoparser.ParseResourceType(entry.ResourceType)
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// readLog returns the requests of an access log. In the combined log format the request line
+// "GET /path HTTP/1.1" gives the URL, relative to base, and the next quoted field the referer.
+// Other lines give a request for the first absolute URL they have, like the ones of proxies.
+func readLog(name string, base *url.URL) ([]*adblockgoparser.Request, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	requests := []*adblockgoparser.Request{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if req := parseLogLine(scanner.Text(), base); req != nil {
+			requests = append(requests, req)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Cannot read log %q: %w", name, err)
+	}
+	return requests, nil
+}
+
+// parseLogLine returns the request of an access log line, nil when it has none
+func parseLogLine(line string, base *url.URL) *adblockgoparser.Request {
+	quoted := quotedFields(line)
+	if len(quoted) > 0 {
+		if request := strings.Fields(quoted[0]); len(request) == 3 && strings.HasPrefix(request[2], "HTTP/") {
+			target, err := url.ParseRequestURI(request[1])
+			switch {
+			case err != nil:
+				return nil
+			case target.Scheme == "http" || target.Scheme == "https":
+			case strings.HasPrefix(request[1], "/") && base != nil:
+				target = base.ResolveReference(target)
+			default:
+				// CONNECT targets, or relative ones without a base to join them with
+				return nil
+			}
+			req := &adblockgoparser.Request{URL: target}
+			if len(quoted) > 1 && quoted[1] != "-" {
+				req.Referer = quoted[1]
+				if page, err := url.Parse(quoted[1]); err == nil && page.IsAbs() {
+					req.PageURL = page
+				}
+			}
+			return req
+		}
+	}
+
+	for _, field := range strings.Fields(line) {
+		field = strings.Trim(field, `"'[]`)
+		if !strings.HasPrefix(field, "http://") && !strings.HasPrefix(field, "https://") {
+			continue
+		}
+		if u, err := url.Parse(field); err == nil {
+			return &adblockgoparser.Request{URL: u}
+		}
+	}
+	return nil
+}
+
+// quotedFields returns the double quoted fields of the line, without their quotes and escapes
+func quotedFields(line string) []string {
+	fields := []string{}
+	for start := strings.IndexByte(line, '"'); start >= 0; start = strings.IndexByte(line, '"') {
+		var field strings.Builder
+		end := -1
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				field.WriteByte(line[i])
+				continue
+			}
+			if line[i] == '"' {
+				end = i
+				break
+			}
+			field.WriteByte(line[i])
+		}
+		if end < 0 {
+			break
+		}
+		fields = append(fields, field.String())
+		line = line[end+1:]
+	}
+	return fields
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adblockcheck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	list := writeFile(t, dir, "easylist.txt", "! EasyList\n||ads.example.com^\n@@/allowed/*\n/track.js$script\n@@||news.com^$document\n")
+	hosts := writeFile(t, dir, "hosts.txt", "0.0.0.0 tracker.example.org\n")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-list", list, "-list", "hosts:" + hosts, "http://ads.example.com/", "http://ads.example.com/allowed/x", "http://example.com/"}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "blocked\thttp://ads.example.com/\t||ads.example.com^ ("+list+":2)\n"+
+		"allowed\thttp://ads.example.com/allowed/x\t@@/allowed/* ("+list+":3)\texception to ||ads.example.com^ ("+list+":2)\n"+
+		"nomatch\thttp://example.com/\n", stdout.String())
+
+	stdout.Reset()
+	stdin := strings.NewReader("http://example.com/track.js\n\nhttp://tracker.example.org/pixel\n")
+	code = run([]string{"-list", list, "-list", "hosts:" + hosts, "-type", "image"}, stdin, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "nomatch\thttp://example.com/track.js\n"+
+		"blocked\thttp://tracker.example.org/pixel\t0.0.0.0 tracker.example.org ("+hosts+":1)\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"-list", list, "-page", "https://news.com/article", "http://ads.example.com/"}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "allowed\thttp://ads.example.com/\t@@||news.com^$document ("+list+":5)\texception to ||ads.example.com^ ("+list+":2)\n", stdout.String())
+	assert.Equal(t, 2, run([]string{"-list", list, "-page", "news.com", "http://example.com/"}, nil, &stdout, &stderr))
+
+	stderr.Reset()
+	odd := writeFile(t, dir, "odd.txt", "||ads.example.com^$rewrite=abp-resource:blank-js\n")
+	assert.Equal(t, 0, run([]string{"-list", odd, "-v", "http://example.com/"}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), odd+":1: Unsupported option rules are skipped: rewrite=abp-resource:blank-js: ||ads.example.com^$rewrite=abp-resource:blank-js\n")
+
+	assert.Equal(t, 2, run([]string{"http://example.com/"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"-list", list, "-type", "nope", "http://example.com/"}, nil, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"-list", filepath.Join(dir, "missing.txt"), "http://example.com/"}, nil, &stdout, &stderr))
+}
+
+func TestRunBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adblockcheck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	list := writeFile(t, dir, "easylist.txt", "||ads.example.com^\n/track.js$script\n")
+	harFile := writeFile(t, dir, "session.har", `{"log": {"entries": [
+		{"request": {"url": "https://news.com/", "headers": []}, "_resourceType": "document"},
+		{"request": {"url": "https://ads.example.com/a.gif", "headers": [{"name": "Referer", "value": "https://news.com/"}]}, "_resourceType": "image"},
+		{"request": {"url": "https://ads.example.com/b.gif", "headers": []}, "_resourceType": "image"},
+		{"request": {"url": "https://cdn.com/track.js", "headers": []}, "_resourceType": "script"},
+		{"request": {"url": "https://cdn.com/track.js?xhr", "headers": []}, "_resourceType": "xhr"}
+	]}}`)
+	logFile := writeFile(t, dir, "access.log", strings.Join([]string{
+		`10.0.0.1 - - [16/Oct/2026:10:00:00 +0000] "GET http://ads.example.com/x HTTP/1.1" 200 12`,
+		`10.0.0.1 - - [16/Oct/2026:10:00:01 +0000] "GET http://example.com/ HTTP/1.1" 200 12`,
+		`garbage`,
+	}, "\n"))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"-list", list, "-har", harFile}, nil, &stdout, &stderr))
+	assert.Equal(t, "requests\t5\nblocked\t3\nallowed\t0\nnomatch\t2\n"+
+		"2\t||ads.example.com^ ("+list+":1)\n"+
+		"1\t/track.js$script ("+list+":2)\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"-list", list, "-log", logFile}, nil, &stdout, &stderr))
+	assert.Equal(t, "requests\t2\nblocked\t1\nallowed\t0\nnomatch\t1\n"+
+		"1\t||ads.example.com^ ("+list+":1)\n", stdout.String())
+}
+
+func TestRunCombinedLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adblockcheck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	list := writeFile(t, dir, "easylist.txt", "||ads.example.net^\n/banner/*$third-party\n")
+	logFile := writeFile(t, dir, "access.log", strings.Join([]string{
+		`10.0.0.2 - - [16/Oct/2026:10:00:00 +0000] "GET /banner/ad.gif HTTP/1.1" 200 43 "http://ads.example.net/landing" "Mozilla/5.0 (X11; Linux x86_64)"`,
+		`10.0.0.2 - - [16/Oct/2026:10:00:01 +0000] "GET /index.html HTTP/1.1" 200 512 "-" "Mozilla/5.0 (X11; Linux x86_64)"`,
+		`10.0.0.3 - - [16/Oct/2026:10:00:02 +0000] "GET /banner/house.gif?q=\"a\" HTTP/1.1" 200 43 "https://example.com/" "curl/7.68.0"`,
+		`10.0.0.3 - - [16/Oct/2026:10:00:03 +0000] "CONNECT ads.example.com:443 HTTP/1.1" 200 0 "-" "-"`,
+	}, "\n"))
+
+	// The referer is the page of the request, not the request itself
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"-list", list, "-log", logFile, "-base", "https://example.com"}, nil, &stdout, &stderr))
+	assert.Equal(t, "requests\t3\nblocked\t1\nallowed\t0\nnomatch\t2\n"+
+		"1\t/banner/*$third-party ("+list+":2)\n", stdout.String())
+
+	// Relative targets can't be checked without a base URL
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"-list", list, "-log", logFile}, nil, &stdout, &stderr))
+	assert.Equal(t, "requests\t0\nblocked\t0\nallowed\t0\nnomatch\t0\n", stdout.String())
+
+	assert.Equal(t, 2, run([]string{"-list", list, "-log", logFile, "-base", "example.com"}, nil, &stdout, &stderr))
+}
@@ -0,0 +1,236 @@
+package adblockgoparser
+
+import (
+	"strings"
+)
+
+// CosmeticRule element hiding rule, hides the elements matching Selector on the pages of its Domains
+type CosmeticRule struct {
+	// Selector is the CSS selector of the rule, the base selector for procedural rules.
+	// It is empty when a procedural rule starts with an operator.
+	Selector string
+	// Operators are applied in order on the elements matching Selector by procedural rules
+	Operators   []SelectorOperator
+	Domains     map[string]bool
+	IsException bool
+	// Raw is the rule as it was written in the list
+	Raw string
+	// Source is the name of the list the rule was loaded from and Line its line number there
+	Source string
+	Line   int
+
+	// body is the whole selector as written, operators included
+	body string
+}
+
+// ParseCosmeticRule parse and create a CosmeticRule from an element hiding rule,
+// ie: "example.com,~sub.example.com##.ad", "example.com#@#.ad" or "example.com#?#div:-abp-has(.ad)"
+func ParseCosmeticRule(ruleText string) (*CosmeticRule, error) {
+	ruleText = strings.TrimSpace(ruleText)
+	if ruleText == "" {
+		return nil, ErrEmptyLine
+	}
+	if strings.HasPrefix(ruleText, "!") || strings.HasPrefix(ruleText, "[Adblock") {
+		return nil, ErrSkipComment
+	}
+
+	domains, separator, selector := splitCosmeticRule(ruleText)
+	switch separator {
+	case "##", "#@#", "#?#", "#@?#":
+	default:
+		return nil, ErrSkipHTML
+	}
+	selector = strings.TrimSpace(selector)
+	// Scriptlets "+js(...)" and HTML filters "^script" aren't CSS selectors
+	if selector == "" || strings.HasPrefix(selector, "+js(") || strings.HasPrefix(selector, "^") {
+		return nil, ErrSkipHTML
+	}
+
+	base, operators, err := ParseProceduralSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &CosmeticRule{
+		Selector:    base,
+		Operators:   operators,
+		Domains:     map[string]bool{},
+		IsException: strings.HasPrefix(separator, "#@"),
+		Raw:         ruleText,
+		body:        selector,
+	}
+	if domains != "" {
+		for _, domain := range strings.Split(domains, ",") {
+			name := strings.TrimSpace(domain)
+			if name == "" || name == "~" || strings.ContainsAny(name, "/^*|$") {
+				return nil, ErrInvalidHTMLRule
+			}
+			rule.Domains[normalizeHostname(strings.TrimPrefix(name, "~"))] = !strings.HasPrefix(name, "~")
+		}
+	}
+	return rule, nil
+}
+
+// splitCosmeticRule splits the rule around its first separator, ie: "##", "#@#" or "#?#"
+func splitCosmeticRule(ruleText string) (domains string, separator string, body string) {
+	start := strings.Index(ruleText, "#")
+	for start >= 0 {
+		end := strings.Index(ruleText[start+1:], "#")
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		if end-start <= 3 {
+			return ruleText[:start], ruleText[start : end+1], ruleText[end+1:]
+		}
+		start = end
+	}
+	return ruleText, "", ""
+}
+
+// isGeneric reports whether the rule applies on every site but the ones it excludes
+func (rule *CosmeticRule) isGeneric() bool {
+	for _, active := range rule.Domains {
+		if active {
+			return false
+		}
+	}
+	return true
+}
+
+// cosmeticMatcher indexes element hiding rules by the domains they apply on
+type cosmeticMatcher struct {
+	// Every rule in the order they were added
+	rules    []*CosmeticRule
+	generic  []*CosmeticRule
+	byDomain map[string][]*CosmeticRule
+	// Exceptions indexed by the selector they disable
+	exceptions map[string][]*CosmeticRule
+}
+
+func newCosmeticMatcher() *cosmeticMatcher {
+	return &cosmeticMatcher{
+		byDomain:   map[string][]*CosmeticRule{},
+		exceptions: map[string][]*CosmeticRule{},
+	}
+}
+
+// Add Rule indexed by its domains, or by its selector for exceptions
+func (cm *cosmeticMatcher) Add(rule *CosmeticRule) {
+	cm.rules = append(cm.rules, rule)
+	switch {
+	case rule.IsException:
+		cm.exceptions[rule.body] = append(cm.exceptions[rule.body], rule)
+	case rule.isGeneric():
+		cm.generic = append(cm.generic, rule)
+	default:
+		for domain, active := range rule.Domains {
+			if active {
+				cm.byDomain[domain] = append(cm.byDomain[domain], rule)
+			}
+		}
+	}
+}
+
+// Match returns the rules applying on the hostname without the ones disabled by an exception.
+// Generic rules are left out when generic is false.
+func (cm *cosmeticMatcher) Match(hostname string, generic bool) []*CosmeticRule {
+	hostname = normalizeHostname(hostname)
+	candidates := []*CosmeticRule{}
+	if generic {
+		candidates = append(candidates, cm.generic...)
+	}
+	for _, domain := range hostnameSuffixes(hostname) {
+		candidates = append(candidates, cm.byDomain[domain]...)
+	}
+
+	rules := []*CosmeticRule{}
+	seen := map[*CosmeticRule]struct{}{}
+	for _, rule := range candidates {
+		if _, ok := seen[rule]; ok {
+			continue
+		}
+		seen[rule] = struct{}{}
+		if domainsMatch(rule.Domains, hostname) && !cm.excepted(rule, hostname) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (cm *cosmeticMatcher) excepted(rule *CosmeticRule, hostname string) bool {
+	for _, exception := range cm.exceptions[rule.body] {
+		if domainsMatch(exception.Domains, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCosmeticRule Adds an element hiding rule
+func (ruleSet *RuleSet) AddCosmeticRule(rule *CosmeticRule) {
+	ruleSet.cosmetic.Add(rule)
+}
+
+// CosmeticSelectors returns the CSS selectors of the elements to hide on the hostname,
+// exceptions already subtracted. Procedural rules are only returned by CosmeticRules.
+func (ruleSet *RuleSet) CosmeticSelectors(hostname string) []string {
+	return selectorsOf(ruleSet.cosmetic.Match(hostname, true))
+}
+
+// CosmeticRules returns the element hiding rules applying on the hostname, procedural ones included,
+// exceptions already subtracted
+func (ruleSet *RuleSet) CosmeticRules(hostname string) []*CosmeticRule {
+	return ruleSet.cosmetic.Match(hostname, true)
+}
+
+// CosmeticRulesForPage returns the element hiding rules applying on the page. A matching
+// $elemhide or $document exception disables them all, a $generichide one disables the generic rules.
+func (ruleSet *RuleSet) CosmeticRulesForPage(page *Request) []*CosmeticRule {
+	if page.ResourceType == TypeUnknown {
+		documentReq := *page
+		documentReq.ResourceType = TypeDocument
+		page = &documentReq
+	}
+	if ruleSet.elemHide.Match(page) != nil || ruleSet.documentExceptions.Match(page) != nil {
+		return []*CosmeticRule{}
+	}
+	generic := ruleSet.genericHide.Match(page) == nil
+	return ruleSet.cosmetic.Match(page.URL.Hostname(), generic)
+}
+
+// selectorsOf returns the selectors of the plain CSS rules
+func selectorsOf(rules []*CosmeticRule) []string {
+	selectors := []string{}
+	seen := map[string]struct{}{}
+	for _, rule := range rules {
+		if _, ok := seen[rule.Selector]; ok || rule.IsProcedural() {
+			continue
+		}
+		seen[rule.Selector] = struct{}{}
+		selectors = append(selectors, rule.Selector)
+	}
+	return selectors
+}
+
+// addHTMLRule adds a rule ParseRule skipped as an HTML rule, either a scriptlet or an element hiding rule
+func (ruleSet *RuleSet) addHTMLRule(ruleText string, source string, line int) error {
+	if isScriptletRule(ruleText) {
+		rule, err := ParseScriptletRule(ruleText)
+		if err != nil {
+			return err
+		}
+		rule.Source = source
+		rule.Line = line
+		ruleSet.AddScriptletRule(rule)
+		return nil
+	}
+	rule, err := ParseCosmeticRule(ruleText)
+	if err != nil {
+		return err
+	}
+	rule.Source = source
+	rule.Line = line
+	ruleSet.AddCosmeticRule(rule)
+	return nil
+}
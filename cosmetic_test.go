@@ -0,0 +1,77 @@
+package adblockgoparser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCosmeticRule(t *testing.T) {
+	rule, err := ParseCosmeticRule("example.com,~Sub.Example.com##div.ad > a")
+	assert.NoError(t, err)
+	assert.Equal(t, "div.ad > a", rule.Selector)
+	assert.Equal(t, map[string]bool{"example.com": true, "sub.example.com": false}, rule.Domains)
+	assert.False(t, rule.IsException)
+
+	rule, err = ParseCosmeticRule("statejournal.com#@##WNAd41")
+	assert.NoError(t, err)
+	assert.Equal(t, "#WNAd41", rule.Selector)
+	assert.True(t, rule.IsException)
+
+	rule, err = ParseCosmeticRule("###AdSense1")
+	assert.NoError(t, err)
+	assert.Equal(t, "#AdSense1", rule.Selector)
+	assert.Empty(t, rule.Domains)
+
+	_, err = ParseCosmeticRule("example.com#$#body { overflow: auto }")
+	assert.Equal(t, ErrSkipHTML, err)
+	_, err = ParseCosmeticRule("example.com##+js(set-constant, ads, true)")
+	assert.Equal(t, ErrSkipHTML, err)
+	_, err = ParseCosmeticRule("||ads.example.com^")
+	assert.Equal(t, ErrSkipHTML, err)
+}
+
+func TestCosmeticSelectors(t *testing.T) {
+	ruleSet := CreateRuleSet()
+	for _, ruleText := range []string{
+		"##.banner",
+		"##.sponsored",
+		"~news.com##.sidebar-ad",
+		"example.com##.promo",
+		"example.com,~shop.example.com##.popup",
+		"shop.example.com#@#.banner",
+		"#@#.sponsored",
+	} {
+		rule, err := ParseCosmeticRule(ruleText)
+		assert.NoError(t, err)
+		ruleSet.AddCosmeticRule(rule)
+	}
+
+	assert.Equal(t, []string{".banner", ".sidebar-ad"}, ruleSet.CosmeticSelectors("other.com"))
+	assert.Equal(t, []string{".banner"}, ruleSet.CosmeticSelectors("www.news.com"))
+	assert.Equal(t, []string{".banner", ".sidebar-ad", ".promo", ".popup"}, ruleSet.CosmeticSelectors("www.example.com"))
+	assert.Equal(t, []string{".sidebar-ad", ".promo"}, ruleSet.CosmeticSelectors("shop.example.com."))
+	assert.Equal(t, []string{".banner", ".sidebar-ad"}, ruleSet.CosmeticSelectors("badexample.com"))
+}
+
+func TestCosmeticRulesForPage(t *testing.T) {
+	list := strings.Join([]string{
+		"##.banner",
+		"example.com##.promo",
+		"@@||example.com^$generichide",
+		"@@||clean.org^$elemhide",
+		"||ads.net^$elemhide",
+	}, "\n")
+	ruleSet, report, err := NewRuleSetFromReader(strings.NewReader(list))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Unsupported)
+
+	rules := ruleSet.CosmeticRulesForPage(reqFromURL("https://www.example.com/article"))
+	assert.Equal(t, []string{".promo"}, selectorsOf(rules))
+	assert.Empty(t, ruleSet.CosmeticRulesForPage(reqFromURL("https://clean.org/")))
+	assert.Equal(t, []string{".banner"}, selectorsOf(ruleSet.CosmeticRulesForPage(reqFromURL("https://other.com/"))))
+
+	// Page exceptions don't allow requests
+	assert.Equal(t, NoMatch, ruleSet.Match(reqFromURL("https://clean.org/")).Verdict)
+}
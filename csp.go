@@ -0,0 +1,36 @@
+package adblockgoparser
+
+// ContentSecurityPolicies returns the Content-Security-Policy values to add to the response of a document
+// or subdocument request, without duplicates and without the ones disabled by an exception.
+// Each policy can be sent in its own header, or all of them joined by ", " in a single one.
+func (ruleSet *RuleSet) ContentSecurityPolicies(req *Request) []string {
+	if req.ResourceType == TypeUnknown {
+		documentReq := *req
+		documentReq.ResourceType = TypeDocument
+		req = &documentReq
+	}
+	policies := []string{}
+	if req.ResourceType != TypeDocument && req.ResourceType != TypeSubdocument {
+		return policies
+	}
+	rules := ruleSet.csp.MatchAll(req)
+	if len(rules) == 0 {
+		return policies
+	}
+
+	disabled := map[string]struct{}{}
+	for _, exception := range ruleSet.cspExceptions.MatchAll(req) {
+		if exception.CSPPolicy == "" {
+			return policies
+		}
+		disabled[exception.CSPPolicy] = struct{}{}
+	}
+	for _, rule := range rules {
+		if _, ok := disabled[rule.CSPPolicy]; ok {
+			continue
+		}
+		disabled[rule.CSPPolicy] = struct{}{}
+		policies = append(policies, rule.CSPPolicy)
+	}
+	return policies
+}
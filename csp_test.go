@@ -0,0 +1,54 @@
+package adblockgoparser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsingCSPRule(t *testing.T) {
+	rule, err := ParseRule("||example.com^$csp=script-src 'self' 'unsafe-inline'")
+	assert.NoError(t, err)
+	assert.True(t, rule.CSP)
+	assert.Equal(t, "script-src 'self' 'unsafe-inline'", rule.CSPPolicy)
+
+	rule, err = ParseRule("@@||example.com^$csp")
+	assert.NoError(t, err)
+	assert.True(t, rule.CSP)
+	assert.Equal(t, "", rule.CSPPolicy)
+
+	_, err = ParseRule("||example.com^$csp")
+	assert.True(t, errors.Is(err, ErrUnsupportedRule))
+	_, err = ParseRule("||example.com^$csp=")
+	assert.EqualError(t, err, "Unsupported option rules are skipped: csp=")
+}
+
+func TestContentSecurityPolicies(t *testing.T) {
+	rules := []string{
+		"||example.com^$csp=script-src 'self'",
+		"||example.com^$csp=worker-src 'none'",
+		"$csp=worker-src 'none'",
+		"@@||trusted.example.com^$csp=script-src 'self'",
+		"@@||open.example.com^$csp",
+		"||news.com^",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"script-src 'self'", "worker-src 'none'"}, ruleSet.ContentSecurityPolicies(reqFromURL("https://www.example.com/")))
+	assert.Equal(t, []string{"worker-src 'none'"}, ruleSet.ContentSecurityPolicies(reqFromURL("https://trusted.example.com/")))
+	assert.Empty(t, ruleSet.ContentSecurityPolicies(reqFromURL("https://open.example.com/")))
+	assert.Equal(t, []string{"worker-src 'none'"}, ruleSet.ContentSecurityPolicies(reqFromURL("https://other.org/")))
+
+	frame := reqFromURL("https://example.com/frame")
+	frame.ResourceType = TypeSubdocument
+	assert.Len(t, ruleSet.ContentSecurityPolicies(frame), 2)
+	script := reqFromURL("https://example.com/app.js")
+	script.ResourceType = TypeScript
+	assert.Empty(t, ruleSet.ContentSecurityPolicies(script))
+
+	// CSP rules don't block
+	assert.True(t, ruleSet.Allow(reqFromURL("https://example.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("https://news.com/")))
+}
@@ -0,0 +1,116 @@
+package adblockgoparser
+
+import (
+	"net"
+	"strings"
+)
+
+// MatchHostname return the decision for a DNS query of the hostname made by the client, along with
+// the rules that took it. Only the rules usable without a URL are considered: "||domain^" rules,
+// hosts entries and their important, badfilter and client options.
+// The client is an IP address or a name, it can be empty when unknown.
+func (ruleSet *RuleSet) MatchHostname(hostname string, client string) *MatchResult {
+	hostname = normalizeHostname(hostname)
+	result := &MatchResult{Verdict: NoMatch}
+	exceptions := []*matcher{ruleSet.importantWhite}
+	result.Rule = ruleSet.importantBlack.MatchHostname(hostname, client)
+	if result.Rule == nil {
+		exceptions = append(exceptions, ruleSet.white)
+		result.Rule = ruleSet.black.MatchHostname(hostname, client)
+	}
+	if result.Rule == nil {
+		return result
+	}
+	result.Verdict = Blocked
+	result.Source = result.Rule.Source
+
+	for _, white := range exceptions {
+		result.Exception = white.MatchHostname(hostname, client)
+		if result.Exception != nil {
+			result.Verdict = AllowedByException
+			result.Source = result.Exception.Source
+			break
+		}
+	}
+	return result
+}
+
+// AllowHostname return if a DNS query of the hostname should be answered
+func (ruleSet *RuleSet) AllowHostname(hostname string) bool {
+	return ruleSet.MatchHostname(hostname, "").Verdict != Blocked
+}
+
+// MatchHostname returns the first DNS level rule matching the hostname or one of its parent domains, or nil
+func (m *matcher) MatchHostname(hostname string, client string) *RuleAdBlock {
+	for _, suffix := range hostnameSuffixes(hostname) {
+		pm := m.domainNameMatcher
+		for _, r := range suffix {
+			if pm = pm.next[r]; pm == nil {
+				break
+			}
+		}
+		if pm == nil {
+			continue
+		}
+		for _, rule := range pm.rules {
+			if isDNSRule(rule) && matchClients(rule, client) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// isDNSRule reports whether the rule only depends on the hostname, ie: "||ads.example.com^$important"
+func isDNSRule(rule *RuleAdBlock) bool {
+	if rule.hosts {
+		return true
+	}
+	if rule.RuleType != DomainName || len(rule.Domains) > 0 {
+		return false
+	}
+	for option := range rule.Options {
+		if option != "match-case" {
+			return false
+		}
+	}
+	return isHostname(strings.ToLower(rule.RuleText[2 : len(rule.RuleText)-1]))
+}
+
+// matchClients checks the client against the clients of the rule, a rule listing only
+// excluded clients applies to every other one, including unknown clients
+func matchClients(rule *RuleAdBlock, client string) bool {
+	included := false
+	hasIncluded := false
+	for value, active := range rule.Clients {
+		hasIncluded = hasIncluded || active
+		if client == "" || !matchClient(value, client) {
+			continue
+		}
+		if !active {
+			return false
+		}
+		included = true
+	}
+	return included || !hasIncluded
+}
+
+// matchClient compares the client with an IP address, a CIDR range or a name
+func matchClient(value string, client string) bool {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		ip := net.ParseIP(client)
+		return ip != nil && network.Contains(ip)
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.Equal(net.ParseIP(client))
+	}
+	return strings.EqualFold(value, client)
+}
+
+// unquoteClient removes the quotes around a client name, ie: 'Frank\'s laptop'
+func unquoteClient(name string) string {
+	if len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0] {
+		return strings.ReplaceAll(name[1:len(name)-1], `\`+name[:1], name[:1])
+	}
+	return name
+}
@@ -0,0 +1,63 @@
+package adblockgoparser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchHostname(t *testing.T) {
+	list := strings.Join([]string{
+		"||ads.example.com^",
+		"||tracker.example.com^$important",
+		"@@||tracker.example.com^",
+		"||cdn.example.com^$third-party",
+		"||example.org/banner^",
+		"/ads/*",
+		"@@||good.ads.example.com^",
+		"||kids.example.net^$client=192.168.1.0/24|~192.168.1.7",
+		"||games.example.net^$client='Frank\\'s laptop'",
+		"||social.example.net^$client=~10.0.0.1",
+	}, "\n")
+	ruleSet := CreateRuleSet()
+	_, err := ruleSet.AddList("dns", strings.NewReader(list))
+	assert.NoError(t, err)
+	_, err = ruleSet.AddHostsList("hosts", strings.NewReader("0.0.0.0 malware.example.org\n"))
+	assert.NoError(t, err)
+
+	assert.False(t, ruleSet.AllowHostname("ads.example.com"))
+	assert.False(t, ruleSet.AllowHostname("www.ADS.example.com."))
+	assert.True(t, ruleSet.AllowHostname("badads.example.com"))
+	assert.True(t, ruleSet.AllowHostname("good.ads.example.com"))
+	assert.False(t, ruleSet.AllowHostname("tracker.example.com"))
+	assert.False(t, ruleSet.AllowHostname("malware.example.org"))
+	// Rules needing a URL or request options don't apply to DNS queries
+	assert.True(t, ruleSet.AllowHostname("cdn.example.com"))
+	assert.True(t, ruleSet.AllowHostname("example.org"))
+	assert.True(t, ruleSet.AllowHostname("ads"))
+
+	result := ruleSet.MatchHostname("tracker.example.com", "")
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.Equal(t, "||tracker.example.com^$important", result.Rule.Raw)
+	assert.Equal(t, 2, result.Rule.Line)
+
+	result = ruleSet.MatchHostname("good.ads.example.com", "")
+	assert.Equal(t, AllowedByException, result.Verdict)
+	assert.Equal(t, "@@||good.ads.example.com^", result.Exception.Raw)
+
+	result = ruleSet.MatchHostname("malware.example.org", "")
+	assert.Equal(t, "hosts", result.Source)
+
+	assert.Equal(t, Blocked, ruleSet.MatchHostname("kids.example.net", "192.168.1.20").Verdict)
+	assert.Equal(t, NoMatch, ruleSet.MatchHostname("kids.example.net", "192.168.1.7").Verdict)
+	assert.Equal(t, NoMatch, ruleSet.MatchHostname("kids.example.net", "10.0.0.1").Verdict)
+	assert.Equal(t, NoMatch, ruleSet.MatchHostname("kids.example.net", "").Verdict)
+	assert.Equal(t, Blocked, ruleSet.MatchHostname("games.example.net", "frank's laptop").Verdict)
+	assert.Equal(t, Blocked, ruleSet.MatchHostname("social.example.net", "").Verdict)
+	assert.Equal(t, NoMatch, ruleSet.MatchHostname("social.example.net", "10.0.0.1").Verdict)
+
+	// Client rules don't apply to requests
+	assert.True(t, ruleSet.Allow(reqFromURL("http://social.example.net/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+}
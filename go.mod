@@ -2,4 +2,8 @@ module github.com/simonfrey/adblockgoparser
 
 go 1.13
 
-require github.com/stretchr/testify v1.5.1
\ No newline at end of file
+require (
+	github.com/andybalholm/cascadia v1.2.0
+	github.com/stretchr/testify v1.5.1
+	golang.org/x/net v0.0.0-20200513185701-a91f0712d120
+)
@@ -0,0 +1,104 @@
+package adblockgoparser
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// normalizeHostname returns the hostname the way rules and requests are compared: lowercased,
+// without trailing dot and with internationalized labels in punycode, ie: "xn--mller-kva.de" for "Müller.de."
+func normalizeHostname(hostname string) string {
+	return toPunycode(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), "."))
+}
+
+// toPunycode converts the internationalized labels of the hostname to punycode
+func toPunycode(hostname string) string {
+	for i := 0; i < len(hostname); i++ {
+		if hostname[i] >= utf8.RuneSelf {
+			if ascii, err := idna.ToASCII(strings.ToLower(hostname)); err == nil {
+				return ascii
+			}
+			return hostname
+		}
+	}
+	return hostname
+}
+
+// normalizeRuleDomain normalizes the domain of a "||domain..." rule text like the hostnames
+// of requests, see normalizeHostname
+func normalizeRuleDomain(text string) string {
+	if !strings.HasPrefix(text, "||") {
+		return text
+	}
+	end := strings.IndexAny(text[2:], "/^*|:?")
+	if end < 0 {
+		end = len(text) - 2
+	}
+	domain := text[2 : 2+end]
+	return "||" + normalizeHostname(domain) + text[2+end:]
+}
+
+// hostnameMatches reports whether the normalized hostname is domain or one of its subdomains.
+// The domain has to match whole labels: "example.com" matches "ads.example.com" but not "badexample.com".
+func hostnameMatches(hostname string, domain string) bool {
+	if !strings.HasSuffix(hostname, domain) {
+		return false
+	}
+	return len(hostname) == len(domain) || hostname[len(hostname)-len(domain)-1] == '.'
+}
+
+// hostnameSuffixes lists the hostname and its parent domains, most specific first
+func hostnameSuffixes(hostname string) []string {
+	suffixes := []string{}
+	for hostname != "" {
+		suffixes = append(suffixes, hostname)
+		dot := strings.Index(hostname, ".")
+		if dot < 0 {
+			break
+		}
+		hostname = hostname[dot+1:]
+	}
+	return suffixes
+}
+
+// domainsMatch applies the most specific of the domains matching the normalized hostname, true for included
+// domains and false for excluded ones. When none matches, only the rules listing no included domain apply.
+func domainsMatch(domains map[string]bool, hostname string) bool {
+	for _, domain := range hostnameSuffixes(hostname) {
+		if active, ok := domains[domain]; ok {
+			return active
+		}
+	}
+	for _, active := range domains {
+		if active {
+			return false
+		}
+	}
+	return true
+}
+
+// labelStart reports whether the i-th rune of the hostname starts one of its labels
+func labelStart(hostname []rune, i int) bool {
+	return i == 0 || hostname[i-1] == '.'
+}
+
+// normalizeRequest returns the request with a trailing dot removed from its hostname and its internationalized
+// labels in punycode, or the request itself when there is nothing to change.
+// The case is kept for match-case rules.
+func normalizeRequest(req *Request) *Request {
+	hostname := req.URL.Hostname()
+	normalized := toPunycode(strings.TrimSuffix(hostname, "."))
+	if hostname == normalized {
+		return req
+	}
+	URL := *req.URL
+	URL.Host = normalized
+	if port := req.URL.Port(); port != "" {
+		URL.Host += ":" + port
+	}
+	normalizedReq := *req
+	normalizedReq.URL = &URL
+	return &normalizedReq
+}
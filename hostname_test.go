@@ -0,0 +1,107 @@
+package adblockgoparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	assert.Equal(t, "ads.example.com", normalizeHostname("Ads.Example.COM."))
+	assert.Equal(t, "xn--mller-kva.de", normalizeHostname("Müller.de"))
+	assert.Equal(t, "xn--mller-kva.de", normalizeHostname("xn--mller-kva.de"))
+	assert.Equal(t, "192.168.0.1", normalizeHostname("192.168.0.1"))
+}
+
+func TestHostnameMatches(t *testing.T) {
+	assert.True(t, hostnameMatches("example.com", "example.com"))
+	assert.True(t, hostnameMatches("ads.example.com", "example.com"))
+	assert.False(t, hostnameMatches("badexample.com", "example.com"))
+	assert.False(t, hostnameMatches("example.com", "ads.example.com"))
+	assert.False(t, hostnameMatches("example.com.ua", "example.com"))
+}
+
+func TestDomainOptionLabelBoundary(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{"/banner/*$domain=example.com", "/promo/*$domain=~example.com"})
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://example.com/banner/a.gif")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://www.example.com/banner/a.gif")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://badexample.com/banner/a.gif")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://sub.example.com/promo/a.gif")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://badexample.com/promo/a.gif")))
+}
+
+func TestDomainNameLabelBoundary(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{"||example.com^", "||müller.de^", "/ad/*$domain=bücher.de"})
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://example.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://www.example.com./")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://badexample.com/")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.community/")))
+
+	assert.False(t, ruleSet.Allow(reqFromURL("http://www.müller.de/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://www.xn--mller-kva.de/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://xn--bcher-kva.de/ad/1.gif")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://bücher.de./ad/1.gif")))
+
+	assert.False(t, ruleSet.AllowHostname("xn--mller-kva.de"))
+	assert.False(t, ruleSet.AllowHostname("müller.de."))
+}
+
+func TestDomainNameMixedCase(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{"||Ads.Example.com^", "||Tracker.Example.ORG.^$script"})
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/x")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://cdn.ADS.example.com/x")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://tracker.example.org/t.js")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/x")))
+
+	// The request and DNS paths share the normalization
+	assert.False(t, ruleSet.AllowHostname("ads.example.com"))
+	assert.False(t, ruleSet.AllowHostname("ADS.EXAMPLE.COM."))
+}
+
+// Domain option examples of the Adblock Plus filter documentation
+func TestDomainOptionSpec(t *testing.T) {
+	cases := []struct {
+		domains  string
+		hostname string
+		applies  bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", true},
+		{"example.com", "example.net", false},
+		{"example.com|example.net", "example.net", true},
+		{"example.com|example.net", "www.example.com", true},
+		{"example.com|example.net", "example.org", false},
+		{"~example.com", "example.net", true},
+		{"~example.com", "example.com", false},
+		{"~example.com", "foo.example.com", false},
+		{"~example.com|~example.net", "example.org", true},
+		{"~example.com|~example.net", "example.net", false},
+		{"example.com|~foo.example.com", "example.com", true},
+		{"example.com|~foo.example.com", "bar.example.com", true},
+		{"example.com|~foo.example.com", "foo.example.com", false},
+		{"example.com|~foo.example.com", "www.foo.example.com", false},
+		{"example.com|~foo.example.com", "example.net", false},
+		{"~foo.example.com|example.com", "foo.example.com", false},
+		{"~foo.example.com|example.com", "example.com", true},
+		{"example.com|~foo.example.com|bar.foo.example.com", "bar.foo.example.com", true},
+		{"example.com|~foo.example.com|bar.foo.example.com", "baz.foo.example.com", false},
+		{"~example.com|foo.example.com", "foo.example.com", true},
+		{"~example.com|foo.example.com", "example.com", false},
+		{"~example.com|foo.example.com", "example.net", false},
+		{"Example.COM", "www.example.com", true},
+		{"example.com", "badexample.com", false},
+	}
+	for _, c := range cases {
+		rule, err := ParseRule("/banner/*$domain=" + c.domains)
+		assert.NoError(t, err)
+		req := reqFromURL("http://" + c.hostname + "/banner/ad.gif")
+		assert.Equal(t, c.applies, matchDomains(rule, req), "$domain=%s on %s", c.domains, c.hostname)
+
+		ruleSet := CreateRuleSet()
+		ruleSet.AddRule(rule)
+		assert.Equal(t, !c.applies, ruleSet.Allow(req), "$domain=%s on %s", c.domains, c.hostname)
+	}
+}
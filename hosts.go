@@ -0,0 +1,125 @@
+package adblockgoparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// ErrSkipLocalHostname Hosts entries for the local machine are skipped
+var ErrSkipLocalHostname = errors.New("Local hostnames are skipped")
+
+// Names hosts files map to the local machine, they are never blocked
+var localHostnames = map[string]struct{}{
+	"localhost":             {},
+	"localhost.localdomain": {},
+	"local":                 {},
+	"broadcasthost":         {},
+	"ip6-localhost":         {},
+	"ip6-loopback":          {},
+	"ip6-localnet":          {},
+	"ip6-mcastprefix":       {},
+	"ip6-allnodes":          {},
+	"ip6-allrouters":        {},
+	"ip6-allhosts":          {},
+}
+
+// ParseHostsRule parse a line of a hosts file, ie: "0.0.0.0 ads.example.com tracker.example.com",
+// or of a plain domain list, ie: "ads.example.com", and create a DomainName rule for each domain.
+// Lines only having entries for the local machine, ie: "127.0.0.1 localhost", or IP addresses
+// return ErrSkipLocalHostname.
+func ParseHostsRule(line string) ([]*RuleAdBlock, error) {
+	text := strings.TrimSpace(line)
+	if text == "" {
+		return nil, ErrEmptyLine
+	}
+	if strings.HasPrefix(text, "#") || strings.HasPrefix(text, "!") {
+		return nil, ErrSkipComment
+	}
+	if comment := strings.Index(text, "#"); comment >= 0 {
+		text = text[:comment]
+	}
+
+	fields := strings.Fields(text)
+	if net.ParseIP(fields[0]) != nil {
+		fields = fields[1:]
+	} else if len(fields) > 1 {
+		return nil, ErrUnsupportedRule
+	}
+
+	rules := []*RuleAdBlock{}
+	for _, field := range fields {
+		domain := normalizeHostname(field)
+		if _, ok := localHostnames[domain]; ok || net.ParseIP(domain) != nil {
+			continue
+		}
+		if !isHostname(domain) {
+			return nil, ErrUnsupportedRule
+		}
+		rules = append(rules, newHostsRule(domain, strings.TrimSpace(line)))
+	}
+	if len(rules) == 0 {
+		return nil, ErrSkipLocalHostname
+	}
+	return rules, nil
+}
+
+// newHostsRule creates the rule blocking the domain and its subdomains.
+// It needs no regex, the domain trie and matchDomains check the whole hostname.
+func newHostsRule(domain string, raw string) *RuleAdBlock {
+	return &RuleAdBlock{
+		RuleText: "||" + domain + "^",
+		Raw:      raw,
+		Domains:  map[string]bool{},
+		Options:  map[string]bool{},
+		RuleType: DomainName,
+		hosts:    true,
+	}
+}
+
+// isHostname reports whether the name only has the characters of a domain name
+func isHostname(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		case c > 127:
+			// Internationalized domain names
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AddHostsList Parses every line of a hosts file or a plain domain list and adds a rule blocking each domain.
+// Lines that can't be used are recorded in the returned report, only read errors are returned.
+func (ruleSet *RuleSet) AddHostsList(name string, r io.Reader) (*ListReport, error) {
+	report := &ListReport{Name: name}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		report.Lines++
+		text := scanner.Text()
+		rules, err := ParseHostsRule(text)
+		if err != nil {
+			report.skip(report.Lines, text, err)
+			continue
+		}
+		for _, rule := range rules {
+			rule.Source = name
+			rule.Line = report.Lines
+			ruleSet.AddRule(rule)
+			report.Rules++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("Cannot read list %q at line %d: %w", name, report.Lines+1, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package adblockgoparser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHostsRule(t *testing.T) {
+	rules, err := ParseHostsRule("0.0.0.0 Ads.Example.com tracker.example.com. # trackers")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "||ads.example.com^", rules[0].RuleText)
+	assert.Equal(t, "||tracker.example.com^", rules[1].RuleText)
+	assert.Equal(t, DomainName, rules[0].RuleType)
+	assert.Nil(t, rules[0].Regex)
+	assert.Equal(t, "0.0.0.0 Ads.Example.com tracker.example.com. # trackers", rules[0].Raw)
+
+	rules, err = ParseHostsRule("ads.example.org")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	_, err = ParseHostsRule("127.0.0.1 localhost localhost.localdomain")
+	assert.Equal(t, ErrSkipLocalHostname, err)
+	_, err = ParseHostsRule("::1 ip6-localhost")
+	assert.Equal(t, ErrSkipLocalHostname, err)
+	_, err = ParseHostsRule("0.0.0.0 0.0.0.0")
+	assert.Equal(t, ErrSkipLocalHostname, err)
+
+	_, err = ParseHostsRule("# comment")
+	assert.Equal(t, ErrSkipComment, err)
+	_, err = ParseHostsRule("   ")
+	assert.Equal(t, ErrEmptyLine, err)
+	_, err = ParseHostsRule("||ads.example.com^")
+	assert.Equal(t, ErrUnsupportedRule, err)
+	_, err = ParseHostsRule("ads.example.com tracker.example.com")
+	assert.Equal(t, ErrUnsupportedRule, err)
+}
+
+func TestAddHostsList(t *testing.T) {
+	list := strings.Join([]string{
+		"# StevenBlack hosts",
+		"127.0.0.1 localhost",
+		"0.0.0.0 ads.example.com",
+		"0.0.0.0 0.0.0.0",
+		"",
+		"tracker.example.org",
+		"0.0.0.0 bad/domain",
+	}, "\n")
+	ruleSet := CreateRuleSet()
+	report, err := ruleSet.AddHostsList("hosts", strings.NewReader(list))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, report.Lines)
+	assert.Equal(t, 2, report.Rules)
+	assert.Equal(t, 1, report.Comments)
+	assert.Equal(t, 1, report.EmptyLines)
+	assert.Equal(t, 1, report.Unsupported)
+	assert.Equal(t, 2, report.LocalHostnames)
+	assert.Len(t, report.Skipped, report.Lines-report.Rules)
+
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("https://sub.ads.example.com/banner.gif")))
+	assert.False(t, ruleSet.Allow(reqFromURL("https://tracker.example.org/pixel")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://badads.example.com/")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/ads.example.com")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://localhost/")))
+
+	result := ruleSet.Match(reqFromURL("http://ads.example.com/"))
+	assert.Equal(t, "hosts", result.Source)
+	assert.Equal(t, 3, result.Rule.Line)
+
+	// Exceptions and badfilters from ABP lists apply to hosts entries
+	_, err = ruleSet.AddList("allowlist", strings.NewReader("@@||tracker.example.org^\n||ads.example.com^$badfilter"))
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("https://tracker.example.org/pixel")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+
+	data, err := ruleSet.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := &RuleSet{}
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assert.True(t, loaded.Allow(reqFromURL("https://tracker.example.org/pixel")))
+	assert.True(t, loaded.Allow(reqFromURL("http://ads.example.com/")))
+}
+
+func TestHostsRuleRoundTrip(t *testing.T) {
+	ruleSet := CreateRuleSet()
+	_, err := ruleSet.AddHostsList("hosts", strings.NewReader("0.0.0.0 ads.example.com tracker.example.com"))
+	assert.NoError(t, err)
+
+	data, err := ruleSet.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := &RuleSet{}
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assert.False(t, loaded.Allow(reqFromURL("http://tracker.example.com/")))
+	assert.False(t, loaded.Allow(reqFromURL("http://www.ads.example.com/")))
+	assert.True(t, loaded.Allow(reqFromURL("http://example.com/")))
+
+	result := loaded.Match(reqFromURL("http://tracker.example.com/"))
+	assert.Equal(t, "0.0.0.0 ads.example.com tracker.example.com", result.Rule.Raw)
+	assert.Equal(t, "hosts", result.Source)
+}
@@ -0,0 +1,230 @@
+// Package htmlfilter applies the element hiding rules of a RuleSet to HTML documents
+package htmlfilter
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/simonfrey/adblockgoparser"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Rules gives the element hiding rules applying on a page,
+// *adblockgoparser.RuleSet and *adblockgoparser.AtomicRuleSet implement it
+type Rules interface {
+	CosmeticRulesForPage(page *adblockgoparser.Request) []*adblockgoparser.CosmeticRule
+}
+
+// Mode defines how the matching elements are hidden
+type Mode int
+
+const (
+	// Remove the matching elements from the document
+	Remove Mode = iota
+	// InjectStyle adds a <style> block hiding the CSS selectors to the document head.
+	// Elements matched by procedural rules, which CSS can't express, get an inline style hiding them.
+	InjectStyle
+)
+
+// hidingStyle is the CSS declaration hiding an element
+const hidingStyle = "display: none !important;"
+
+// Filter applies element hiding rules to HTML documents, it is safe for concurrent use
+type Filter struct {
+	rules Rules
+	mode  Mode
+	// Compiled selectors by their text, nil when they can't be compiled
+	selectors sync.Map
+}
+
+// Result tells what was done to a document
+type Result struct {
+	// Rules applying on the page
+	Rules []*adblockgoparser.CosmeticRule
+	// Elements is the number of elements removed, or hidden inline
+	Elements int
+}
+
+// New Creates a Filter hiding elements as defined by mode
+func New(rules Rules, mode Mode) *Filter {
+	return &Filter{
+		rules: rules,
+		mode:  mode,
+	}
+}
+
+// Filter reads the HTML document of the page from r and writes it to w without its ads
+func (f *Filter) Filter(w io.Writer, r io.Reader, pageURL *url.URL) (*Result, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	result := f.Document(doc, pageURL)
+	if err := html.Render(w, doc); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Document applies the rules of the page to a parsed HTML document
+func (f *Filter) Document(doc *html.Node, pageURL *url.URL) *Result {
+	result := &Result{
+		Rules: f.rules.CosmeticRulesForPage(&adblockgoparser.Request{
+			URL:          pageURL,
+			ResourceType: adblockgoparser.TypeDocument,
+		}),
+	}
+
+	css := []string{}
+	matched := []*html.Node{}
+	seen := map[*html.Node]struct{}{}
+	for _, rule := range result.Rules {
+		if style, ok := styleOf(rule); ok {
+			// Style rules change the elements instead of hiding them, there is nothing to remove
+			if f.mode == InjectStyle && style != "" {
+				for _, node := range f.evaluate(doc, rule.Selector, rule.Operators[:len(rule.Operators)-1]) {
+					addStyle(node, style)
+				}
+			}
+			continue
+		}
+		if f.mode == InjectStyle && !rule.IsProcedural() {
+			if f.compile(rule.Selector) != nil {
+				css = append(css, rule.Selector)
+			}
+			continue
+		}
+		for _, node := range f.evaluate(doc, rule.Selector, rule.Operators) {
+			if _, ok := seen[node]; !ok {
+				seen[node] = struct{}{}
+				matched = append(matched, node)
+			}
+		}
+	}
+
+	for _, node := range matched {
+		switch f.mode {
+		case InjectStyle:
+			hide(node)
+		default:
+			if node.Parent != nil {
+				node.Parent.RemoveChild(node)
+			}
+		}
+	}
+	result.Elements = len(matched)
+
+	if len(css) > 0 {
+		injectStyle(doc, css)
+	}
+	return result
+}
+
+// compile returns the cached compiled selector, nil when it isn't supported
+func (f *Filter) compile(selector string) cascadia.Selector {
+	if compiled, ok := f.selectors.Load(selector); ok {
+		return compiled.(cascadia.Selector)
+	}
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		compiled = nil
+	}
+	f.selectors.Store(selector, compiled)
+	return compiled
+}
+
+// hide sets an inline style hiding the element
+func hide(node *html.Node) {
+	addStyle(node, hidingStyle)
+}
+
+// addStyle appends the declarations to the inline style of the element
+func addStyle(node *html.Node, style string) {
+	for i, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, "style") {
+			node.Attr[i].Val = strings.TrimSuffix(strings.TrimSpace(attr.Val), ";") + "; " + style
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: "style", Val: style})
+}
+
+// styleOf returns the declarations of a rule ending with ":style()", ie: "body:style(overflow: auto !important)".
+// Like uBlock Origin, styles loading resources with url() are refused and ok is true but the style empty.
+func styleOf(rule *adblockgoparser.CosmeticRule) (style string, ok bool) {
+	if len(rule.Operators) == 0 || rule.Operators[len(rule.Operators)-1].Name != "style" {
+		return "", false
+	}
+	style = strings.TrimSpace(rule.Operators[len(rule.Operators)-1].Arg)
+	if strings.Contains(strings.ToLower(style), "url(") {
+		return "", true
+	}
+	return style, true
+}
+
+// injectStyle appends a <style> block hiding the selectors to the document head.
+// Each selector gets its own CSS rule so that one the browser rejects doesn't disable the others.
+func injectStyle(doc *html.Node, selectors []string) {
+	var style strings.Builder
+	for _, selector := range selectors {
+		writeStyleSelector(&style, selector)
+		style.WriteString(" { ")
+		style.WriteString(hidingStyle)
+		style.WriteString(" }\n")
+	}
+
+	node := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "style",
+		DataAtom: atom.Style,
+	}
+	node.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: style.String(),
+	})
+
+	parent := findElement(doc, atom.Head)
+	if parent == nil {
+		parent = findElement(doc, atom.Html)
+	}
+	if parent == nil {
+		parent = doc
+	}
+	parent.AppendChild(node)
+}
+
+// writeStyleSelector writes the selector with "<" CSS-escaped. The text of a <style> element
+// isn't escaped by html.Render, a selector like a[title="</style><script>"] would close it.
+func writeStyleSelector(style *strings.Builder, selector string) {
+	for i := 0; i < len(selector); i++ {
+		switch {
+		case selector[i] == '<':
+			style.WriteString(`\3c `)
+		case selector[i] == '\\' && i+1 < len(selector) && selector[i+1] == '<':
+			// "\<" is an escaped "<", write it as the code point escape alone
+			style.WriteString(`\3c `)
+			i++
+		case selector[i] == '\\' && i+1 < len(selector):
+			style.WriteString(selector[i : i+2])
+			i++
+		default:
+			style.WriteByte(selector[i])
+		}
+	}
+}
+
+func findElement(node *html.Node, a atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == a {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package htmlfilter
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/simonfrey/adblockgoparser"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const page = `<html><head><title>News</title></head><body>
+<div class="banner">Buy now</div>
+<article><p>Story</p></article>
+<article><span class="label">Sponsored</span><p>Ad</p></article>
+<div id="promo" style="color: red">Promo</div>
+</body></html>`
+
+func newRuleSet(t *testing.T, rules ...string) *adblockgoparser.RuleSet {
+	ruleSet, _, err := adblockgoparser.NewRuleSetFromReader(strings.NewReader(strings.Join(rules, "\n")))
+	assert.NoError(t, err)
+	return ruleSet
+}
+
+func filterPage(t *testing.T, filter *Filter, rawURL string) (string, *Result) {
+	pageURL, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	result, err := filter.Filter(&out, strings.NewReader(page), pageURL)
+	assert.NoError(t, err)
+	return out.String(), result
+}
+
+func TestFilterRemovesElements(t *testing.T) {
+	ruleSet := newRuleSet(t,
+		"##.banner",
+		"news.com##article:has(.label:has-text(/sponsored/i))",
+		"news.com###promo",
+		"other.com##p",
+	)
+
+	out, result := filterPage(t, New(ruleSet, Remove), "https://www.news.com/")
+	assert.Equal(t, 3, result.Elements)
+	assert.Len(t, result.Rules, 3)
+	assert.NotContains(t, out, "Buy now")
+	assert.NotContains(t, out, "Sponsored")
+	assert.NotContains(t, out, "Promo")
+	assert.Contains(t, out, "<article><p>Story</p></article>")
+}
+
+func TestFilterInjectsStyle(t *testing.T) {
+	ruleSet := newRuleSet(t,
+		"##.banner",
+		"##div::before",
+		"news.com#?#.label:upward(1)",
+		"news.com###promo",
+	)
+
+	out, result := filterPage(t, New(ruleSet, InjectStyle), "https://news.com/")
+	assert.Equal(t, 1, result.Elements)
+	assert.Contains(t, out, "<style>.banner { display: none !important; }\n#promo { display: none !important; }\n</style></head>")
+	assert.Contains(t, out, `<article style="display: none !important;"><span class="label">`)
+	assert.Contains(t, out, "Buy now")
+}
+
+func TestFilterInjectedStyleCannotCloseStyleElement(t *testing.T) {
+	ruleSet := newRuleSet(t, `##a[title="</style><script>alert(1)</script>"]`)
+
+	out, _ := filterPage(t, New(ruleSet, InjectStyle), "https://news.com/")
+	assert.NotContains(t, out, "<script>")
+	assert.Contains(t, out, `<style>a[title="\3c /style>\3c script>alert(1)\3c /script>"] { display: none !important; }`)
+
+	doc, err := html.Parse(strings.NewReader(out))
+	assert.NoError(t, err)
+	assert.Nil(t, findElement(doc, atom.Script))
+}
+
+func TestFilterStyleRules(t *testing.T) {
+	ruleSet := newRuleSet(t,
+		"news.com##body:style(overflow: auto !important)",
+		"news.com##html,body:style(position: static !important)",
+		"news.com###promo:style(background: url(https://tracker.com/p.gif))",
+	)
+
+	// Styles don't remove anything
+	out, result := filterPage(t, New(ruleSet, Remove), "https://news.com/")
+	assert.Equal(t, 0, result.Elements)
+	assert.Len(t, result.Rules, 3)
+	assert.Contains(t, out, "<body>")
+	assert.Contains(t, out, "Buy now")
+	assert.Contains(t, out, `<div id="promo" style="color: red">Promo</div>`)
+
+	out, result = filterPage(t, New(ruleSet, InjectStyle), "https://news.com/")
+	assert.Equal(t, 0, result.Elements)
+	assert.Contains(t, out, `<html style="position: static !important">`)
+	assert.Contains(t, out, `<body style="overflow: auto !important; position: static !important">`)
+	assert.Contains(t, out, `<div id="promo" style="color: red">Promo</div>`)
+	assert.NotContains(t, out, "display: none")
+}
+
+func TestFilterHonorsPageExceptions(t *testing.T) {
+	ruleSet := newRuleSet(t,
+		"##.banner",
+		"news.com###promo",
+		"@@||news.com^$generichide",
+		"@@||clean.org^$elemhide",
+	)
+	filter := New(ruleSet, Remove)
+
+	out, _ := filterPage(t, filter, "https://news.com/")
+	assert.Contains(t, out, "Buy now")
+	assert.NotContains(t, out, "Promo")
+
+	out, result := filterPage(t, filter, "https://clean.org/")
+	assert.Equal(t, 0, result.Elements)
+	assert.Contains(t, out, "Buy now")
+}
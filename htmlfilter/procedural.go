@@ -0,0 +1,244 @@
+package htmlfilter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/simonfrey/adblockgoparser"
+	"golang.org/x/net/html"
+)
+
+// evaluate returns the elements below root matching the base selector and the operators following it.
+// Rules using an operator that can't be evaluated without a browser, ie: ":xpath()" or ":matches-css()", match nothing.
+func (f *Filter) evaluate(root *html.Node, base string, operators []adblockgoparser.SelectorOperator) []*html.Node {
+	nodes := f.query(root, base)
+	for _, operator := range operators {
+		if len(nodes) == 0 {
+			break
+		}
+		nodes = f.apply(nodes, operator)
+	}
+	return nodes
+}
+
+// query returns the elements matching the selector relative to node: its descendants,
+// or its children and siblings when the selector starts with a combinator
+func (f *Filter) query(node *html.Node, selector string) []*html.Node {
+	selector = strings.TrimSpace(selector)
+	var candidates []*html.Node
+	switch {
+	case strings.HasPrefix(selector, ">"):
+		candidates = children(node)
+	case strings.HasPrefix(selector, "+"):
+		if sibling := nextElement(node); sibling != nil {
+			candidates = []*html.Node{sibling}
+		}
+	case strings.HasPrefix(selector, "~"):
+		for sibling := nextElement(node); sibling != nil; sibling = nextElement(sibling) {
+			candidates = append(candidates, sibling)
+		}
+	default:
+		candidates = descendants(node)
+	}
+	selector = strings.TrimSpace(strings.TrimLeft(selector, ">+~"))
+	if selector == "" {
+		return candidates
+	}
+
+	compiled := f.compile(selector)
+	if compiled == nil {
+		return nil
+	}
+	return compiled.Filter(candidates)
+}
+
+// matches reports whether the node itself matches the procedural selector
+func (f *Filter) matches(node *html.Node, selector string) bool {
+	base, operators, err := adblockgoparser.ParseProceduralSelector(selector)
+	if err != nil {
+		return false
+	}
+	if base != "" {
+		compiled := f.compile(base)
+		if compiled == nil || !compiled.Match(node) {
+			return false
+		}
+	}
+	nodes := []*html.Node{node}
+	for _, operator := range operators {
+		nodes = f.apply(nodes, operator)
+	}
+	return len(nodes) > 0
+}
+
+func (f *Filter) apply(nodes []*html.Node, operator adblockgoparser.SelectorOperator) []*html.Node {
+	switch operator.Name {
+	case "has":
+		base, operators, err := adblockgoparser.ParseProceduralSelector(operator.Arg)
+		if err != nil {
+			return nil
+		}
+		return filter(nodes, func(node *html.Node) bool {
+			return len(f.evaluate(node, base, operators)) > 0
+		})
+	case "not":
+		return filter(nodes, func(node *html.Node) bool {
+			return !f.matches(node, operator.Arg)
+		})
+	case "has-text":
+		match := textMatcher(operator.Arg)
+		return filter(nodes, func(node *html.Node) bool {
+			return match(text(node))
+		})
+	case "min-text-length":
+		length, err := strconv.Atoi(strings.TrimSpace(operator.Arg))
+		if err != nil {
+			return nil
+		}
+		return filter(nodes, func(node *html.Node) bool {
+			return utf8.RuneCountInString(text(node)) >= length
+		})
+	case "upward":
+		return unique(nodes, func(node *html.Node) []*html.Node {
+			if ancestor := f.upward(node, operator.Arg); ancestor != nil {
+				return []*html.Node{ancestor}
+			}
+			return nil
+		})
+	case "spath":
+		arg := operator.Arg
+		trimmed := strings.TrimSpace(arg)
+		// CSS right after an operator narrows down the same elements, ie: ".large"
+		if trimmed == arg && !strings.ContainsAny(trimmed[:1], ">+~") {
+			compiled := f.compile("*" + trimmed)
+			if compiled == nil {
+				return nil
+			}
+			return compiled.Filter(nodes)
+		}
+		return unique(nodes, func(node *html.Node) []*html.Node {
+			return f.query(node, arg)
+		})
+	case "remove":
+		// Action, the elements get hidden anyway
+		return nodes
+	}
+	// ":style()" doesn't hide elements, Document applies it on its own
+	return nil
+}
+
+// upward returns the nth ancestor element, or the closest one matching a selector
+func (f *Filter) upward(node *html.Node, arg string) *html.Node {
+	arg = strings.TrimSpace(arg)
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > 256 {
+			return nil
+		}
+		for ; n > 0 && node != nil; n-- {
+			node = node.Parent
+		}
+		if node == nil || node.Type != html.ElementNode {
+			return nil
+		}
+		return node
+	}
+
+	compiled := f.compile(arg)
+	if compiled == nil {
+		return nil
+	}
+	for node = node.Parent; node != nil && node.Type == html.ElementNode; node = node.Parent {
+		if compiled.Match(node) {
+			return node
+		}
+	}
+	return nil
+}
+
+// textMatcher matches text against "/regex/flags" or a plain substring
+func textMatcher(arg string) func(string) bool {
+	if strings.HasPrefix(arg, "/") && strings.LastIndex(arg, "/") > 0 {
+		end := strings.LastIndex(arg, "/")
+		pattern, flags := arg[1:end], arg[end+1:]
+		if strings.Contains(flags, "i") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return func(string) bool { return false }
+		}
+		return re.MatchString
+	}
+	return func(text string) bool {
+		return strings.Contains(text, arg)
+	}
+}
+
+// text returns the text content of the node
+func text(node *html.Node) string {
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return builder.String()
+}
+
+func filter(nodes []*html.Node, keep func(*html.Node) bool) []*html.Node {
+	kept := []*html.Node{}
+	for _, node := range nodes {
+		if keep(node) {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// unique collects the nodes found from each node, without duplicates
+func unique(nodes []*html.Node, find func(*html.Node) []*html.Node) []*html.Node {
+	found := []*html.Node{}
+	seen := map[*html.Node]struct{}{}
+	for _, node := range nodes {
+		for _, result := range find(node) {
+			if _, ok := seen[result]; !ok {
+				seen[result] = struct{}{}
+				found = append(found, result)
+			}
+		}
+	}
+	return found
+}
+
+func children(node *html.Node) []*html.Node {
+	elements := []*html.Node{}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+func descendants(node *html.Node) []*html.Node {
+	return cascadia.QueryAll(node, cascadia.Selector(func(n *html.Node) bool {
+		return n.Type == html.ElementNode
+	}))
+}
+
+func nextElement(node *html.Node) *html.Node {
+	for sibling := node.NextSibling; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type == html.ElementNode {
+			return sibling
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package adblockgoparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp/syntax"
+)
+
+// maxLineLength is the longest line accepted when reading a filter list
+const maxLineLength = 1024 * 1024
+
+// SkippedLine describes a line of a filter list that didn't produce a rule
+type SkippedLine struct {
+	Line int
+	Text string
+	Err  error
+}
+
+// ListReport summarizes the result of loading a filter list into a RuleSet
+type ListReport struct {
+	Name         string
+	Lines        int
+	Rules        int
+	Cosmetic     int
+	Scriptlets   int
+	Comments     int
+	HTML         int
+	Unsupported  int
+	InvalidRegex int
+	InvalidHTML  int
+	EmptyLines   int
+	// LocalHostnames counts the hosts file lines only mapping the local machine or IP addresses
+	LocalHostnames int
+	// Invalid counts the lines skipped for any other error
+	Invalid int
+	Skipped []SkippedLine
+	// UnsupportedOptions counts the rules skipped because of each option
+	UnsupportedOptions map[string]int
+}
+
+func (report *ListReport) skip(line int, text string, err error) {
+	switch {
+	case errors.Is(err, ErrSkipComment):
+		report.Comments++
+	case errors.Is(err, ErrSkipHTML):
+		report.HTML++
+	case errors.Is(err, ErrUnsupportedRule):
+		report.Unsupported++
+		var optionErr *UnsupportedOptionError
+		if errors.As(err, &optionErr) {
+			if report.UnsupportedOptions == nil {
+				report.UnsupportedOptions = map[string]int{}
+			}
+			report.UnsupportedOptions[optionErr.Option]++
+		}
+	case errors.Is(err, ErrEmptyLine):
+		report.EmptyLines++
+	case errors.Is(err, ErrSkipLocalHostname):
+		report.LocalHostnames++
+	case errors.Is(err, ErrInvalidHTMLRule):
+		report.InvalidHTML++
+	case errors.As(err, new(*syntax.Error)):
+		// The rule or its removeparam pattern can't be compiled to a regex
+		report.InvalidRegex++
+	default:
+		report.Invalid++
+	}
+	report.Skipped = append(report.Skipped, SkippedLine{
+		Line: line,
+		Text: text,
+		Err:  err,
+	})
+}
+
+// NewRuleSetFromReader Creates a RuleSet from an EasyList-style filter list
+func NewRuleSetFromReader(r io.Reader) (*RuleSet, *ListReport, error) {
+	ruleSet := CreateRuleSet()
+	report, err := ruleSet.AddList("", r)
+	if err != nil {
+		return nil, report, err
+	}
+	return ruleSet, report, nil
+}
+
+// AddList Parses every line of an EasyList-style filter list and adds the supported rules,
+// element hiding rules included.
+// Lines that can't be used are recorded in the returned report, only read errors are returned.
+func (ruleSet *RuleSet) AddList(name string, r io.Reader) (*ListReport, error) {
+	report := &ListReport{Name: name}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		report.Lines++
+		text := scanner.Text()
+		rule, err := ParseRule(text)
+		if errors.Is(err, ErrSkipHTML) {
+			err = ruleSet.addHTMLRule(text, name, report.Lines)
+			if err == nil && isScriptletRule(text) {
+				report.Scriptlets++
+				continue
+			}
+			if err == nil {
+				report.Cosmetic++
+				continue
+			}
+		}
+		if err != nil {
+			report.skip(report.Lines, text, err)
+			continue
+		}
+		rule.Source = name
+		rule.Line = report.Lines
+		ruleSet.AddRule(rule)
+		report.Rules++
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("Cannot read list %q at line %d: %w", name, report.Lines+1, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,85 @@
+package adblockgoparser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRuleSetFromReader(t *testing.T) {
+	list := strings.Join([]string{
+		"[Adblock Plus 2.0]",
+		"! Title: EasyList",
+		"",
+		"||ads.example.com^",
+		"example.com#$#body { overflow: auto }",
+		"||domain.net^$badoption",
+		"/banner[/",
+		"@@||ads.example.com^$script",
+		"###AdSense1",
+	}, "\n")
+
+	ruleSet, report, err := NewRuleSetFromReader(strings.NewReader(list))
+	assert.NoError(t, err)
+	assert.Equal(t, 9, report.Lines)
+	assert.Equal(t, 2, report.Rules)
+	assert.Equal(t, 1, report.Cosmetic)
+	assert.Equal(t, 2, report.Comments)
+	assert.Equal(t, 1, report.EmptyLines)
+	assert.Equal(t, 1, report.HTML)
+	assert.Equal(t, 1, report.Unsupported)
+	assert.Equal(t, 1, report.InvalidRegex)
+
+	var lines []int
+	for _, skipped := range report.Skipped {
+		lines = append(lines, skipped.Line)
+	}
+	assert.Equal(t, []int{1, 2, 3, 5, 6, 7}, lines)
+	assert.Equal(t, "/banner[/", report.Skipped[5].Text)
+	assert.True(t, errors.Is(report.Skipped[4].Err, ErrUnsupportedRule))
+	assert.Equal(t, map[string]int{"badoption": 1}, report.UnsupportedOptions)
+
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/file.js")))
+	assert.Equal(t, []string{"#AdSense1"}, ruleSet.CosmeticSelectors("example.com"))
+}
+
+func TestListReportInvalidRules(t *testing.T) {
+	list := strings.Join([]string{
+		"/banner[/",
+		"$removeparam=/utm_(/",
+		"example.com##div:has-text(unbalanced",
+		"example.com#%#//scriptlet(set-constant)",
+		"example.com#$#body { overflow: auto }",
+	}, "\n")
+	_, report, err := NewRuleSetFromReader(strings.NewReader(list))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.InvalidRegex)
+	assert.Equal(t, 2, report.InvalidHTML)
+	assert.Equal(t, 1, report.HTML)
+	assert.Equal(t, 0, report.Invalid)
+}
+
+func TestListWithOneCharacterLines(t *testing.T) {
+	ruleSet, report, err := NewRuleSetFromReader(strings.NewReader("||ads.com^\nx\n|\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Lines)
+	assert.Equal(t, 3, report.Rules)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://example.com/x.html")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/")))
+}
+
+func TestAddListLayersRules(t *testing.T) {
+	ruleSet := CreateRuleSet()
+	report, err := ruleSet.AddList("easylist", strings.NewReader("||ads.example.com^\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "easylist", report.Name)
+	assert.Equal(t, 1, report.Rules)
+
+	_, err = ruleSet.AddList("custom", strings.NewReader("@@||ads.example.com^"))
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+}
@@ -0,0 +1,70 @@
+package adblockgoparser
+
+import "net/url"
+
+// pagesOf returns the documents page level exceptions are checked against: the request itself
+// when it loads a page or a frame, and the page it is made for
+func pagesOf(req *Request) []*Request {
+	pages := []*Request{}
+	if reqType := requestType(req); reqType == TypeDocument || reqType == TypeSubdocument {
+		pages = append(pages, &Request{URL: req.URL, ResourceType: TypeDocument})
+	}
+	if req.PageURL != nil && req.PageURL.Hostname() != "" {
+		pages = append(pages, &Request{URL: req.PageURL, ResourceType: TypeDocument})
+	}
+	return pages
+}
+
+// matchPages returns the first rule of the matcher that accept takes among the ones matching the pages
+func matchPages(m *matcher, pages []*Request, accept func(*RuleAdBlock) bool) *RuleAdBlock {
+	for _, page := range pages {
+		if rule := m.matchWhere(page, accept); rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// pageHostname returns the hostname of the page the request is made for, see sourceHostname,
+// or the one of the request when its page is unknown
+func pageHostname(req *Request) string {
+	if source := sourceHostname(req); source != "" {
+		return source
+	}
+	return req.URL.Hostname()
+}
+
+// sourceHostname returns the hostname of the page the request is made for: the one of its PageURL,
+// or of its Origin or Referer headers. It is empty when the request doesn't say who made it.
+func sourceHostname(req *Request) string {
+	if req.PageURL != nil && req.PageURL.Hostname() != "" {
+		return req.PageURL.Hostname()
+	}
+	for _, source := range []string{req.Origin, req.Referer} {
+		if source == "" || source == "null" {
+			continue
+		}
+		if sourceURL, err := url.Parse(source); err == nil && sourceURL.Hostname() != "" {
+			return sourceURL.Hostname()
+		}
+	}
+	return ""
+}
+
+func anyRule(rule *RuleAdBlock) bool {
+	return true
+}
+
+func isImportantRule(rule *RuleAdBlock) bool {
+	return rule.Important
+}
+
+// isSpecificRule reports whether the rule is restricted to some domains, $genericblock exceptions keep those
+func isSpecificRule(rule *RuleAdBlock) bool {
+	for _, active := range rule.Domains {
+		if active {
+			return true
+		}
+	}
+	return false
+}
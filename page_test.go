@@ -0,0 +1,98 @@
+package adblockgoparser
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reqFromPage(rawURL string, page string) *Request {
+	req := reqFromURL(rawURL)
+	req.PageURL, _ = url.Parse(page)
+	return req
+}
+
+func TestDocumentException(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{
+		"||ads.example.com^",
+		"||tracker.example.org^$important",
+		"@@||trusted.com^$document",
+		"@@||partner.com^$document,important",
+	})
+	assert.NoError(t, err)
+
+	assert.False(t, ruleSet.Allow(reqFromPage("http://ads.example.com/ad.js", "https://news.com/")))
+	result := ruleSet.Match(reqFromPage("http://ads.example.com/ad.js", "https://www.trusted.com/article"))
+	assert.Equal(t, AllowedByException, result.Verdict)
+	assert.Equal(t, "@@||trusted.com^$document", result.Exception.Raw)
+	assert.Equal(t, "||ads.example.com^", result.Rule.Raw)
+
+	// Important blocking rules are only overridden by important document exceptions
+	assert.False(t, ruleSet.Allow(reqFromPage("http://tracker.example.org/t.js", "https://trusted.com/")))
+	assert.True(t, ruleSet.Allow(reqFromPage("http://tracker.example.org/t.js", "https://partner.com/")))
+
+	// Pages and frames are their own page
+	req := reqFromURL("http://ads.example.com/frame.html")
+	req.ResourceType = TypeSubdocument
+	assert.False(t, ruleSet.Allow(req))
+	req = reqFromPage("http://ads.trusted.com/frame.html", "https://news.com/")
+	req.ResourceType = TypeSubdocument
+	assert.Equal(t, NoMatch, ruleSet.Match(req).Verdict)
+
+	// Without a page the exception doesn't apply to subresources
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/ad.js")))
+}
+
+func TestDocumentExceptionDisablesElementHiding(t *testing.T) {
+	ruleSet, _, err := NewRuleSetFromReader(strings.NewReader("##.ad\n@@||trusted.com^$document\n"))
+	assert.NoError(t, err)
+	assert.Len(t, ruleSet.CosmeticRulesForPage(reqFromURL("https://news.com/")), 1)
+	assert.Empty(t, ruleSet.CosmeticRulesForPage(reqFromURL("https://trusted.com/")))
+}
+
+func TestGenericBlockException(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{
+		"/banner/*",
+		"/sponsor/*$domain=news.com",
+		"/promo/*$domain=~blog.com",
+		"@@||news.com^$genericblock",
+	})
+	assert.NoError(t, err)
+
+	assert.False(t, ruleSet.Allow(reqFromPage("http://cdn.com/banner/1.png", "https://blog.com/")))
+	assert.True(t, ruleSet.Allow(reqFromPage("http://cdn.com/banner/1.png", "https://news.com/")))
+	assert.True(t, ruleSet.Allow(reqFromPage("http://cdn.com/promo/1.png", "https://news.com/")))
+	assert.False(t, ruleSet.Allow(reqFromPage("http://cdn.com/sponsor/1.png", "https://news.com/")))
+}
+
+func TestPageURLOptions(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{
+		"||cdn.com^$third-party",
+		"/widget/*$domain=news.com",
+	})
+	assert.NoError(t, err)
+
+	// The page decides whether the request is third-party, before its Referer
+	req := reqFromPage("http://cdn.com/lib.js", "https://www.cdn.com/")
+	req.Referer = "https://news.com/"
+	assert.True(t, ruleSet.Allow(req))
+	assert.False(t, ruleSet.Allow(reqFromPage("http://cdn.com/lib.js", "https://news.com/")))
+
+	// The domain option is checked against the page
+	assert.False(t, ruleSet.Allow(reqFromPage("http://static.net/widget/w.js", "https://news.com/")))
+	assert.True(t, ruleSet.Allow(reqFromPage("http://static.net/widget/w.js", "https://blog.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://news.com/widget/w.js")))
+
+	// Without page, both options fall back to the Referer
+	req = reqFromURL("http://static.net/widget/w.js")
+	req.Referer = "http://news.com/"
+	assert.False(t, ruleSet.Allow(req))
+	req = reqFromURL("http://news.com/widget/w.js")
+	req.Referer = "http://blog.com/"
+	assert.True(t, ruleSet.Allow(req))
+	req = reqFromURL("http://cdn.com/lib.js")
+	req.Referer = "http://news.com/"
+	assert.False(t, ruleSet.Allow(req))
+}
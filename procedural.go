@@ -0,0 +1,170 @@
+package adblockgoparser
+
+import (
+	"strings"
+)
+
+// SelectorOperator is a step of a procedural cosmetic rule, ie: ":has-text(/sponsored/i)"
+type SelectorOperator struct {
+	// Name of the operator, aliases use the uBlock Origin name: "has", "has-text", "upward"...
+	// "spath" holds plain CSS found between two operators, ie: " > span" or ".large"
+	Name string
+	// Arg is the text between the parentheses, as written
+	Arg string
+}
+
+// Procedural operators by their name in filter lists, pointing to their uBlock Origin name
+var proceduralOperators = map[string]string{
+	"has":                "has",
+	"-abp-has":           "has",
+	"if":                 "has",
+	"if-not":             "not",
+	"not":                "not",
+	"has-text":           "has-text",
+	"-abp-contains":      "has-text",
+	"contains":           "has-text",
+	"xpath":              "xpath",
+	"upward":             "upward",
+	"nth-ancestor":       "upward",
+	"matches-css":        "matches-css",
+	"-abp-properties":    "matches-css",
+	"matches-css-before": "matches-css-before",
+	"matches-css-after":  "matches-css-after",
+	"matches-attr":       "matches-attr",
+	"matches-path":       "matches-path",
+	"matches-media":      "matches-media",
+	"min-text-length":    "min-text-length",
+	"watch-attr":         "watch-attr",
+	"others":             "others",
+	"remove":             "remove",
+	"style":              "style",
+}
+
+// IsProcedural reports whether the rule needs its Operators to be evaluated
+func (rule *CosmeticRule) IsProcedural() bool {
+	return len(rule.Operators) > 0
+}
+
+// ParseProceduralSelector splits a selector into its CSS base selector and the procedural
+// operators following it, ie: the argument of ":has()". Plain CSS selectors are returned without operators.
+func ParseProceduralSelector(selector string) (string, []SelectorOperator, error) {
+	base := ""
+	operators := []SelectorOperator{}
+	// last is the start of the CSS not consumed by an operator yet
+	last := 0
+	quote := byte(0)
+	brackets, parens := 0, 0
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			brackets++
+		case c == ']':
+			brackets--
+		case c == '(':
+			parens++
+		case c == ')':
+			parens--
+		case c == ':' && brackets == 0 && parens == 0:
+			name, arg, end, err := readOperator(selector, i)
+			if err != nil {
+				return "", nil, err
+			}
+			if name == "" {
+				continue
+			}
+			css := selector[last:i]
+			if len(operators) == 0 {
+				base = css
+			} else if strings.TrimSpace(css) != "" {
+				operators = append(operators, SelectorOperator{Name: "spath", Arg: css})
+			}
+			operators = append(operators, SelectorOperator{Name: name, Arg: arg})
+			last = end
+			i = end - 1
+		}
+		if brackets < 0 || parens < 0 {
+			return "", nil, ErrInvalidHTMLRule
+		}
+	}
+	if quote != 0 || brackets != 0 || parens != 0 {
+		return "", nil, ErrInvalidHTMLRule
+	}
+
+	if len(operators) == 0 {
+		return strings.TrimSpace(selector), nil, nil
+	}
+	if rest := selector[last:]; strings.TrimSpace(rest) != "" {
+		operators = append(operators, SelectorOperator{Name: "spath", Arg: rest})
+	}
+	return strings.TrimSpace(base), operators, nil
+}
+
+// readOperator reads the procedural operator starting at the colon. It returns an empty name
+// when it is a CSS pseudo-class, and end is the index following the closing parenthesis.
+func readOperator(selector string, colon int) (name string, arg string, end int, err error) {
+	start := colon + 1
+	open := start
+	for open < len(selector) && (selector[open] == '-' || isLetter(selector[open])) {
+		open++
+	}
+	if open >= len(selector) || selector[open] != '(' {
+		return "", "", 0, nil
+	}
+	name, ok := proceduralOperators[selector[start:open]]
+	if !ok {
+		return "", "", 0, nil
+	}
+
+	// Text arguments aren't quoted, a lone apostrophe is part of the text
+	quotes := name != "has-text"
+	quote := byte(0)
+	depth := 1
+	for end = open + 1; end < len(selector) && depth > 0; end++ {
+		c := selector[end]
+		switch {
+		case c == '\\':
+			end++
+		case !quotes:
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+	}
+	if depth != 0 {
+		return "", "", 0, ErrInvalidHTMLRule
+	}
+	arg = selector[open+1 : end-1]
+
+	// :not() is plain CSS unless it wraps a procedural selector
+	if selector[start:open] == "not" {
+		if _, operators, err := ParseProceduralSelector(arg); err != nil || len(operators) == 0 {
+			return "", "", 0, err
+		}
+	}
+	return name, arg, end, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,73 @@
+package adblockgoparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProceduralRule(t *testing.T) {
+	rule, err := ParseCosmeticRule("mobile.twitter.com#?#.tweet:-abp-has(.promo)")
+	assert.NoError(t, err)
+	assert.Equal(t, ".tweet", rule.Selector)
+	assert.Equal(t, []SelectorOperator{{Name: "has", Arg: ".promo"}}, rule.Operators)
+	assert.True(t, rule.IsProcedural())
+
+	rule, err = ParseCosmeticRule(`example.com##div.card:has-text(/Sponsored \(ad\)/i):upward(2) > .body`)
+	assert.NoError(t, err)
+	assert.Equal(t, "div.card", rule.Selector)
+	assert.Equal(t, []SelectorOperator{
+		{Name: "has-text", Arg: `/Sponsored \(ad\)/i`},
+		{Name: "upward", Arg: "2"},
+		{Name: "spath", Arg: " > .body"},
+	}, rule.Operators)
+
+	rule, err = ParseCosmeticRule(`##:xpath(//div[@class="ad"])`)
+	assert.NoError(t, err)
+	assert.Equal(t, "", rule.Selector)
+	assert.Equal(t, []SelectorOperator{{Name: "xpath", Arg: `//div[@class="ad"]`}}, rule.Operators)
+
+	rule, err = ParseCosmeticRule(`example.com#?#div:-abp-contains(Promoted):not(:has-text(keep))`)
+	assert.NoError(t, err)
+	assert.Equal(t, []SelectorOperator{
+		{Name: "has-text", Arg: "Promoted"},
+		{Name: "not", Arg: ":has-text(keep)"},
+	}, rule.Operators)
+
+	rule, err = ParseCosmeticRule(`##a[href^="http://ads."]:not(.keep)::before`)
+	assert.NoError(t, err)
+	assert.Equal(t, `a[href^="http://ads."]:not(.keep)::before`, rule.Selector)
+	assert.False(t, rule.IsProcedural())
+
+	rule, err = ParseCosmeticRule("example.com##p:has-text(don't miss)")
+	assert.NoError(t, err)
+	assert.Equal(t, []SelectorOperator{{Name: "has-text", Arg: "don't miss"}}, rule.Operators)
+
+	_, err = ParseCosmeticRule("example.com##div:has-text(unbalanced")
+	assert.Equal(t, ErrInvalidHTMLRule, err)
+}
+
+func TestCosmeticRulesWithProcedural(t *testing.T) {
+	ruleSet := CreateRuleSet()
+	for _, ruleText := range []string{
+		"##.banner",
+		"example.com#?#div:has-text(Sponsored)",
+		"example.com##article:has(.ad)",
+		"shop.example.com#@?#div:has-text(Sponsored)",
+	} {
+		rule, err := ParseCosmeticRule(ruleText)
+		assert.NoError(t, err)
+		ruleSet.AddCosmeticRule(rule)
+	}
+
+	assert.Equal(t, []string{".banner"}, ruleSet.CosmeticSelectors("example.com"))
+
+	rules := ruleSet.CosmeticRules("example.com")
+	assert.Len(t, rules, 3)
+	assert.Equal(t, "div", rules[1].Selector)
+	assert.Equal(t, "has-text", rules[1].Operators[0].Name)
+
+	rules = ruleSet.CosmeticRules("shop.example.com")
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "article", rules[1].Selector)
+}
@@ -0,0 +1,103 @@
+package adblockgoparser
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// parseRemoveParam reads the value of a "removeparam" option
+func parseRemoveParam(rule *RuleAdBlock, pattern string) error {
+	rule.RemoveParam = true
+	rule.RemoveParamPattern = pattern
+
+	regex := strings.TrimPrefix(pattern, "~")
+	end := strings.LastIndex(regex, "/")
+	if !strings.HasPrefix(regex, "/") || end < 1 {
+		return nil
+	}
+	flags := regex[end+1:]
+	regex = regex[1:end]
+	if strings.Contains(flags, "i") {
+		regex = "(?i)" + regex
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return fmt.Errorf("Cannot compile removeparam Regex: %w", err)
+	}
+	rule.removeParamRegex = re
+	return nil
+}
+
+// removesParam reports whether the rule removes the query parameter
+func (rule *RuleAdBlock) removesParam(name string, value string) bool {
+	pattern := rule.RemoveParamPattern
+	if pattern == "" {
+		return true
+	}
+	invert := strings.HasPrefix(pattern, "~")
+	match := false
+	if rule.removeParamRegex != nil {
+		match = rule.removeParamRegex.MatchString(name + "=" + value)
+	} else {
+		match = name == strings.TrimPrefix(pattern, "~")
+	}
+	return match != invert
+}
+
+// RemoveParams returns the URL of the request without the query parameters removed by the removeparam rules
+// matching it. Exceptions disable the rules with the same pattern, or every rule when their pattern is empty.
+// The request URL itself is returned when no parameter is removed.
+func (ruleSet *RuleSet) RemoveParams(req *Request) *url.URL {
+	if req.URL.RawQuery == "" {
+		return req.URL
+	}
+	rules := ruleSet.removeParams.MatchAll(req)
+	if len(rules) == 0 {
+		return req.URL
+	}
+	disabled := map[string]struct{}{}
+	for _, exception := range ruleSet.removeParamExceptions.MatchAll(req) {
+		if exception.RemoveParamPattern == "" {
+			return req.URL
+		}
+		disabled[exception.RemoveParamPattern] = struct{}{}
+	}
+
+	kept := []string{}
+	removed := false
+	for _, param := range strings.Split(req.URL.RawQuery, "&") {
+		name, value := param, ""
+		if equal := strings.Index(param, "="); equal >= 0 {
+			name, value = param[:equal], param[equal+1:]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+
+		remove := false
+		for _, rule := range rules {
+			if _, ok := disabled[rule.RemoveParamPattern]; !ok && rule.removesParam(name, value) {
+				remove = true
+				break
+			}
+		}
+		if remove {
+			removed = true
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if !removed {
+		return req.URL
+	}
+
+	cleaned := *req.URL
+	cleaned.RawQuery = strings.Join(kept, "&")
+	cleaned.ForceQuery = false
+	return &cleaned
+}
@@ -0,0 +1,78 @@
+package adblockgoparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsingRemoveParamRule(t *testing.T) {
+	rule, err := ParseRule("$removeparam=fbclid")
+	assert.NoError(t, err)
+	assert.True(t, rule.RemoveParam)
+	assert.Equal(t, "fbclid", rule.RemoveParamPattern)
+	assert.Equal(t, RegexRule, rule.RuleType)
+
+	rule, err = ParseRule("||example.com^$removeparam=/^utm_/i")
+	assert.NoError(t, err)
+	assert.True(t, rule.removesParam("UTM_source", "x"))
+	assert.False(t, rule.removesParam("id", "utm_"))
+
+	rule, err = ParseRule("@@||example.com^$removeparam")
+	assert.NoError(t, err)
+	assert.True(t, rule.RemoveParam)
+	assert.True(t, rule.IsException)
+	assert.Equal(t, "", rule.RemoveParamPattern)
+
+	_, err = ParseRule("$removeparam=/utm_[/")
+	assert.Error(t, err)
+}
+
+func TestParsingRemoveParamRegexWithComma(t *testing.T) {
+	rule, err := ParseRule("||example.com^$removeparam=/^x{1,3}=/,script")
+	assert.NoError(t, err)
+	assert.Equal(t, "/^x{1,3}=/", rule.RemoveParamPattern)
+	assert.True(t, rule.Types.Has(TypeScript))
+	assert.True(t, rule.removesParam("xx", "1"))
+	assert.False(t, rule.removesParam("xxxx", "1"))
+
+	rule, err = ParseRule("$removeparam=~/^(id|page),?$/i,domain=example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "~/^(id|page),?$/i", rule.RemoveParamPattern)
+	assert.Equal(t, map[string]bool{"example.com": true}, rule.Domains)
+
+	// uBlock Origin escapes commas in option values
+	rule, err = ParseRule("$removeparam=a\\,b")
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b", rule.RemoveParamPattern)
+}
+
+func TestRemoveParams(t *testing.T) {
+	rules := []string{
+		"$removeparam=/^utm_/",
+		"$removeparam=fbclid",
+		"$removeparam=gclid",
+		"||shop.example.com^$removeparam=~id",
+		"||clean.example.com^$removeparam",
+		"@@||ads.example.com^$removeparam=gclid",
+		"@@||keep.example.com^$removeparam",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	clean := func(rawURL string) string {
+		return ruleSet.RemoveParams(reqFromURL(rawURL)).String()
+	}
+	assert.Equal(t, "http://news.com/a?id=1&b=c%20d", clean("http://news.com/a?utm_source=x&id=1&fbclid=abc&b=c%20d&utm_medium=y"))
+	assert.Equal(t, "http://news.com/a", clean("http://news.com/a?fbclid=abc"))
+	assert.Equal(t, "http://shop.example.com/p?id=3", clean("http://shop.example.com/p?ref=home&id=3&x=1"))
+	assert.Equal(t, "http://clean.example.com/", clean("http://clean.example.com/?a=1&b=2"))
+	assert.Equal(t, "http://ads.example.com/?gclid=1", clean("http://ads.example.com/?gclid=1&fbclid=2"))
+	assert.Equal(t, "http://keep.example.com/?fbclid=2", clean("http://keep.example.com/?fbclid=2"))
+
+	req := reqFromURL("http://news.com/a?id=1")
+	assert.True(t, req.URL == ruleSet.RemoveParams(req))
+
+	// Removeparam rules don't block
+	assert.True(t, ruleSet.Allow(reqFromURL("http://clean.example.com/?a=1")))
+}
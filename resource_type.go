@@ -0,0 +1,73 @@
+package adblockgoparser
+
+// ResourceType identifies the kind of resource a request loads
+type ResourceType int
+
+const (
+	// TypeUnknown lets the type be guessed from the request URL
+	TypeUnknown ResourceType = iota
+	TypeDocument
+	TypeSubdocument
+	TypeScript
+	TypeImage
+	TypeStylesheet
+	TypeObject
+	TypeXMLHTTPRequest
+	TypeMedia
+	TypeFont
+	TypeWebsocket
+	TypePing
+	TypeOther
+	TypeWebRTC
+	// TypePopup is a page opened in a new window or tab
+	TypePopup
+)
+
+var resourceTypeNames = map[ResourceType]string{
+	TypeUnknown:        "unknown",
+	TypeDocument:       "document",
+	TypeSubdocument:    "subdocument",
+	TypeScript:         "script",
+	TypeImage:          "image",
+	TypeStylesheet:     "stylesheet",
+	TypeObject:         "object",
+	TypeXMLHTTPRequest: "xmlhttprequest",
+	TypeMedia:          "media",
+	TypeFont:           "font",
+	TypeWebsocket:      "websocket",
+	TypePing:           "ping",
+	TypeOther:          "other",
+	TypeWebRTC:         "webrtc",
+	TypePopup:          "popup",
+}
+
+// ResourceTypeMask is a set of resource types
+type ResourceTypeMask uint32
+
+// Mask returns the set holding only the type
+func (t ResourceType) Mask() ResourceTypeMask {
+	return 1 << uint(t)
+}
+
+// Has reports whether the type is in the set
+func (m ResourceTypeMask) Has(t ResourceType) bool {
+	return m&t.Mask() != 0
+}
+
+// String returns the filter option name of the type
+func (t ResourceType) String() string {
+	if name, ok := resourceTypeNames[t]; ok {
+		return name
+	}
+	return resourceTypeNames[TypeUnknown]
+}
+
+// ParseResourceType returns the ResourceType named like its filter option, ie: "script"
+func ParseResourceType(name string) (ResourceType, bool) {
+	for t, typeName := range resourceTypeNames {
+		if t != TypeUnknown && typeName == name {
+			return t, true
+		}
+	}
+	return TypeUnknown, false
+}
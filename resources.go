@@ -0,0 +1,151 @@
+package adblockgoparser
+
+import (
+	"encoding/base64"
+)
+
+// Resource is a neutered replacement served to the requests a redirect rule applies to
+type Resource struct {
+	// Name of the resource as written in uBlock Origin lists, ie: "noopjs"
+	Name        string
+	ContentType string
+	Body        []byte
+}
+
+// Resources bundled with the package by their uBlock Origin name
+var resources = map[string]*Resource{}
+
+// Other names of the resources, AdGuard ones included
+var resourceAliases = map[string]string{
+	"noop.js":                           "noopjs",
+	"blank-js":                          "noopjs",
+	"noopframe":                         "noop.html",
+	"blank-html":                        "noop.html",
+	"noop.txt":                          "nooptext",
+	"noopcss":                           "noop.css",
+	"blank-css":                         "noop.css",
+	"noopjson":                          "noop.json",
+	"1x1-transparent.gif":               "1x1.gif",
+	"1x1-transparent-gif":               "1x1.gif",
+	"2x2-transparent.png":               "2x2.png",
+	"2x2-transparent-png":               "2x2.png",
+	"3x2-transparent.png":               "3x2.png",
+	"3x2-transparent-png":               "3x2.png",
+	"32x32-transparent.png":             "32x32.png",
+	"32x32-transparent-png":             "32x32.png",
+	"google-analytics":                  "google-analytics_analytics.js",
+	"google-analytics.com/analytics.js": "google-analytics_analytics.js",
+	"googletagmanager-gtm":              "googletagmanager_gtm.js",
+	"googletagmanager.com/gtm.js":       "googletagmanager_gtm.js",
+}
+
+func init() {
+	for _, resource := range []*Resource{
+		{Name: "noopjs", ContentType: "application/javascript", Body: []byte("(function() {\n\t'use strict';\n})();\n")},
+		{Name: "noop.html", ContentType: "text/html", Body: []byte("<!DOCTYPE html>\n<html><head></head><body></body></html>\n")},
+		{Name: "nooptext", ContentType: "text/plain", Body: []byte{}},
+		{Name: "empty", ContentType: "text/plain", Body: []byte{}},
+		{Name: "noop.css", ContentType: "text/css", Body: []byte{}},
+		{Name: "noop.json", ContentType: "application/json", Body: []byte("{}")},
+		{Name: "1x1.gif", ContentType: "image/gif", Body: decodeResource("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")},
+		{Name: "2x2.png", ContentType: "image/png", Body: decodeResource("iVBORw0KGgoAAAANSUhEUgAAAAIAAAACCAYAAABytg0kAAAAC0lEQVR42mNgQAcAABIAAeRVjecAAAAASUVORK5CYII=")},
+		{Name: "3x2.png", ContentType: "image/png", Body: decodeResource("iVBORw0KGgoAAAANSUhEUgAAAAMAAAACCAYAAACddGYaAAAAC0lEQVR42mNgwAUAABoAAS+Yl6YAAAAASUVORK5CYII=")},
+		{Name: "32x32.png", ContentType: "image/png", Body: decodeResource("iVBORw0KGgoAAAANSUhEUgAAACAAAAAgCAYAAABzenr0AAAAGklEQVR42u3BAQEAAACCIP+vbkhAAQAAAO8GECAAAcm1w7EAAAAASUVORK5CYII=")},
+		{Name: "google-analytics_analytics.js", ContentType: "application/javascript", Body: []byte(googleAnalyticsStub)},
+		{Name: "googletagmanager_gtm.js", ContentType: "application/javascript", Body: []byte(googleTagManagerStub)},
+	} {
+		resources[resource.Name] = resource
+	}
+}
+
+func decodeResource(data string) []byte {
+	body, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+// LookupResource returns the bundled resource by its name or one of its aliases
+func LookupResource(name string) (*Resource, bool) {
+	if alias, ok := resourceAliases[name]; ok {
+		name = alias
+	}
+	resource, ok := resources[name]
+	return resource, ok
+}
+
+// googleAnalyticsStub replaces analytics.js: ga() calls do nothing but their hitCallback still runs,
+// pages waiting for it to navigate keep working
+const googleAnalyticsStub = `(function() {
+	'use strict';
+	var noopfn = function() {};
+	var Tracker = function() {};
+	Tracker.prototype.get = noopfn;
+	Tracker.prototype.set = noopfn;
+	Tracker.prototype.send = noopfn;
+	var w = window;
+	var gaName = w.GoogleAnalyticsObject || 'ga';
+	var ga = function() {
+		var args = Array.prototype.slice.call(arguments);
+		if (args.length === 0) {
+			return;
+		}
+		var last = args[args.length - 1];
+		var callback;
+		if (last instanceof Object && typeof last.hitCallback === 'function') {
+			callback = last.hitCallback;
+		} else if (typeof last === 'function') {
+			callback = function() { last(ga.create()); };
+		} else {
+			var pos = args.indexOf('hitCallback');
+			if (pos !== -1 && typeof args[pos + 1] === 'function') {
+				callback = args[pos + 1];
+			}
+		}
+		if (typeof callback !== 'function') {
+			return;
+		}
+		try {
+			callback();
+		} catch (ex) {
+		}
+	};
+	ga.create = function() { return new Tracker(); };
+	ga.getByName = function() { return new Tracker(); };
+	ga.getAll = function() { return [new Tracker()]; };
+	ga.remove = noopfn;
+	ga.loaded = true;
+	w[gaName] = ga;
+	var dl = w.dataLayer;
+	if (dl instanceof Object && dl.hide instanceof Object && typeof dl.hide.end === 'function') {
+		dl.hide.end();
+	}
+})();
+`
+
+// googleTagManagerStub replaces gtm.js: the eventCallback of the events pushed to the data layer still runs
+const googleTagManagerStub = `(function() {
+	'use strict';
+	var w = window;
+	var dl = w.dataLayer;
+	if (!(dl instanceof Object)) {
+		return;
+	}
+	if (dl.hide instanceof Object && typeof dl.hide.end === 'function') {
+		dl.hide.end();
+	}
+	var run = function(event) {
+		if (event instanceof Object && typeof event.eventCallback === 'function') {
+			setTimeout(event.eventCallback, 1);
+		}
+	};
+	if (typeof dl.push === 'function') {
+		Array.prototype.forEach.call(dl, run);
+		dl.push = function(event) {
+			run(event);
+			return 0;
+		};
+	}
+})();
+`
@@ -1,8 +1,11 @@
 package adblockgoparser
 
 import (
+	"net"
 	"path/filepath"
 	"strings"
+
+	"golang.org/x/net/publicsuffix"
 )
 
 type matcher struct {
@@ -10,6 +13,8 @@ type matcher struct {
 	domainNameMatcher   *pathMatcher
 	exactAddressMatcher *pathMatcher
 	regexpRules         []*RuleAdBlock
+	// Rules indexed by their normalized text
+	index map[string][]*RuleAdBlock
 }
 
 type pathMatcher struct {
@@ -17,22 +22,56 @@ type pathMatcher struct {
 	rules []*RuleAdBlock
 }
 
+func newMatcher() *matcher {
+	return &matcher{
+		addressPartMatcher: &pathMatcher{
+			next: map[rune]*pathMatcher{},
+		},
+		domainNameMatcher: &pathMatcher{
+			next: map[rune]*pathMatcher{},
+		},
+		exactAddressMatcher: &pathMatcher{
+			next: map[rune]*pathMatcher{},
+		},
+		index: map[string][]*RuleAdBlock{},
+	}
+}
+
 // Add Rule in a structured way to be able to match with Request
 func (m *matcher) Add(rule *RuleAdBlock) {
-	var runes []rune
+	key := rule.filterKey()
+	m.index[key] = append(m.index[key], rule)
+	if rule.RuleType == RegexRule {
+		m.regexpRules = append(m.regexpRules, rule)
+		return
+	}
+	pm, runes := m.pathOf(rule)
+	pm.addPath(runes, rule)
+}
+
+// Remove every rule indexed under the normalized text
+func (m *matcher) Remove(key string) {
+	for _, rule := range m.index[key] {
+		if rule.RuleType == RegexRule {
+			m.regexpRules = removeRule(m.regexpRules, rule)
+			continue
+		}
+		pm, runes := m.pathOf(rule)
+		pm.removePath(runes, rule)
+	}
+	delete(m.index, key)
+}
+
+// pathOf returns the trie holding the rule and the runes leading to it
+func (m *matcher) pathOf(rule *RuleAdBlock) (*pathMatcher, []rune) {
 	text := strings.ToLower(rule.RuleText)
 	switch rule.RuleType {
-	case AddressPart:
-		runes = []rune(text)
-		m.addressPartMatcher.addPath(runes, rule)
 	case DomainName:
-		runes = []rune(text[2 : len(text)-1])
-		m.domainNameMatcher.addPath(runes, rule)
+		return m.domainNameMatcher, []rune(text[2 : len(text)-1])
 	case ExactAddress:
-		runes = []rune(text[1 : len(text)-1])
-		m.exactAddressMatcher.addPath(runes, rule)
-	case RegexRule:
-		m.regexpRules = append(m.regexpRules, rule)
+		return m.exactAddressMatcher, []rune(text[1 : len(text)-1])
+	default:
+		return m.addressPartMatcher, []rune(text)
 	}
 }
 
@@ -55,47 +94,100 @@ func (pm *pathMatcher) addPath(runes []rune, rule *RuleAdBlock) {
 	pm.next[runes[0]].addPath(runes[1:], rule)
 }
 
-// Match the Request against all rules
-func (m *matcher) Match(req *Request) bool {
+func (pm *pathMatcher) removePath(runes []rune, rule *RuleAdBlock) {
+	if len(runes) == 0 || string(runes[0]) == "^" {
+		pm.rules = removeRule(pm.rules, rule)
+		return
+	}
+	if next, ok := pm.next[runes[0]]; ok {
+		next.removePath(runes[1:], rule)
+	}
+}
+
+func removeRule(rules []*RuleAdBlock, rule *RuleAdBlock) []*RuleAdBlock {
+	for i := range rules {
+		if rules[i] == rule {
+			return append(rules[:i:i], rules[i+1:]...)
+		}
+	}
+	return rules
+}
+
+// Match the Request against all rules, returning the first matching rule or nil
+func (m *matcher) Match(req *Request) *RuleAdBlock {
+	return m.matchWhere(req, anyRule)
+}
+
+// matchWhere returns the first rule matching the Request that accept takes
+func (m *matcher) matchWhere(req *Request, accept func(*RuleAdBlock) bool) *RuleAdBlock {
+	var found *RuleAdBlock
+	m.visit(req, func(rule *RuleAdBlock) bool {
+		if !accept(rule) {
+			return false
+		}
+		found = rule
+		return true
+	})
+	return found
+}
+
+// MatchAll returns every rule matching the Request
+func (m *matcher) MatchAll(req *Request) []*RuleAdBlock {
+	rules := []*RuleAdBlock{}
+	seen := map[*RuleAdBlock]struct{}{}
+	m.visit(req, func(rule *RuleAdBlock) bool {
+		if _, ok := seen[rule]; !ok {
+			seen[rule] = struct{}{}
+			rules = append(rules, rule)
+		}
+		return false
+	})
+	return rules
+}
+
+// visit calls found with each rule matching the Request until it returns true
+func (m *matcher) visit(req *Request, found func(*RuleAdBlock) bool) bool {
+	req = normalizeRequest(req)
 	// Match path
 	pathRunes := []rune(strings.ToLower(req.URL.Path))
 	for i := range pathRunes {
-		if m.addressPartMatcher.findNext(pathRunes[i:], req) {
+		if m.addressPartMatcher.findNext(pathRunes[i:], req, found) {
 			return true
 		}
 	}
 
-	// Match domain and subdomains
+	// Match domain and subdomains, starting at each label
 	hnRunes := []rune(strings.ToLower(req.URL.Hostname()))
 	for i := range hnRunes {
-		if m.domainNameMatcher.findNext(hnRunes[i:], req) {
+		if labelStart(hnRunes, i) && m.domainNameMatcher.findNext(hnRunes[i:], req, found) {
 			return true
 		}
 	}
 
 	// Match exact address
 	URLRunes := []rune(strings.ToLower(req.URL.String()))
-	if m.exactAddressMatcher.findNext(URLRunes, req) {
+	if m.exactAddressMatcher.findNext(URLRunes, req, found) {
 		return true
 	}
 
 	// Match direct regexp
 	URL := req.URL.String()
 	for _, rule := range m.regexpRules {
-		if rule.Regex.MatchString(URL) {
+		if matchDomains(rule, req) && matchOptions(rule, req) && rule.matchURL(URL) && found(rule) {
 			return true
 		}
 	}
 	return false
 }
 
-func (pm *pathMatcher) findNext(runes []rune, req *Request) bool {
-	match := false
+func (pm *pathMatcher) findNext(runes []rune, req *Request, found func(*RuleAdBlock) bool) bool {
 	// If find some rules in the current rune, try to match
 	if len(pm.rules) != 0 {
 		for _, rule := range pm.rules {
-			if matchDomains(rule, req) && matchOptions(rule, req) && rule.Regex.MatchString(req.URL.String()) { // This line need to be removed and add simpler validation
-				return true
+			if matchDomains(rule, req) && matchOptions(rule, req) && rule.matchURL(req.URL.String()) { // This line need to be removed and add simpler validation
+				if found(rule) {
+					return true
+				}
 			}
 		}
 	}
@@ -103,20 +195,18 @@ func (pm *pathMatcher) findNext(runes []rune, req *Request) bool {
 	// If still have runes to looking for
 	if len(runes) != 0 {
 		// Go to the next expected rune
-		if _, ok := pm.next[runes[0]]; ok {
-			match = pm.next[runes[0]].findNext(runes[1:], req)
-			if match {
+		if next, ok := pm.next[runes[0]]; ok {
+			if next.findNext(runes[1:], req, found) {
 				return true
 			}
 		}
 	}
 
 	// If the current path match has a wildcard
-	if _, ok := pm.next['*']; ok && !match {
+	if wildcard, ok := pm.next['*']; ok {
 		// Start ignoring characters from URL
 		for i := range runes {
-			match := pm.next['*'].findNext(runes[i:], req)
-			if match {
+			if wildcard.findNext(runes[i:], req, found) {
 				return true
 			}
 		}
@@ -126,77 +216,86 @@ func (pm *pathMatcher) findNext(runes []rune, req *Request) bool {
 	return false
 }
 
+// matchDomains checks the hostname of the request against the domain of DomainName rules and the domain option
 func matchDomains(rule *RuleAdBlock, req *Request) bool {
-	allowedDomain := true
-	matchCase := false
-	hostname := req.URL.Hostname()
-	if _, matchCase = rule.Options["match-case"]; !matchCase {
-		hostname = strings.ToLower(hostname)
-	}
-	if rule.RuleType == DomainName {
-		if !strings.HasSuffix(hostname, rule.RuleText[2:len(rule.RuleText)-1]) {
-			allowedDomain = false
-		}
+	hostname := normalizeHostname(req.URL.Hostname())
+	if rule.RuleType == DomainName && !hostnameMatches(hostname, rule.RuleText[2:len(rule.RuleText)-1]) {
+		return false
 	}
-	if len(rule.Domains) > 0 {
-		for domain, active := range rule.Domains {
-			if !matchCase {
-				domain = strings.ToLower(domain)
-			}
-			if !(strings.HasSuffix(hostname, domain) == active) {
-				allowedDomain = false
-				break
-			}
+	return domainsMatch(rule.Domains, normalizeHostname(pageHostname(req)))
+}
+
+func matchOptions(rule *RuleAdBlock, req *Request) bool {
+	// Requests don't tell which client made them
+	if len(rule.Clients) > 0 {
+		return false
+	}
+	if active, ok := rule.Options["third-party"]; ok {
+		if thirdParty, known := isThirdParty(req); known && thirdParty != active {
+			return false
 		}
 	}
-	return allowedDomain
+
+	// A rule listing types only applies to those types, a rule listing only excluded types
+	// applies to everything else but popups, they need an explicit $popup option
+	reqType := requestType(req)
+	if reqType == TypePopup && !rule.Types.Has(TypePopup) {
+		return false
+	}
+	if rule.Types != 0 && !rule.Types.Has(reqType) {
+		return false
+	}
+	return !rule.ExcludedTypes.Has(reqType)
 }
 
-func matchOptions(rule *RuleAdBlock, req *Request) bool {
-	matchOption := true
+// requestType returns the resource type of the request. When the caller didn't set it,
+// it is guessed from IsXHR and the extension of the URL path.
+func requestType(req *Request) ResourceType {
+	if req.ResourceType != TypeUnknown {
+		return req.ResourceType
+	}
+	if req.IsXHR {
+		return TypeXMLHTTPRequest
+	}
+
 	path := strings.ToLower(req.URL.Path)
 	if strings.HasSuffix(path, ".gz") {
 		path = path[:len(path)-len(".gz")]
 	}
+	switch filepath.Ext(path) {
+	case ".js", ".mjs":
+		return TypeScript
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".tiff", ".psd", ".raw", ".bmp", ".heif", ".indd", ".jpeg2000", ".svg", ".ico", ".avif":
+		return TypeImage
+	case ".css":
+		return TypeStylesheet
+	case ".otf", ".ttf", ".fnt", ".woff", ".woff2", ".eot":
+		return TypeFont
+	case ".mp4", ".webm", ".mp3", ".ogg", ".wav", ".m4a", ".m3u8":
+		return TypeMedia
+	}
+	return TypeOther
+}
 
-	if len(rule.Options) > 0 {
-		matchOption = false
-		for option, active := range rule.Options {
-			switch {
-			case option == "xmlhttprequest":
-			case option == "third-party":
-			case option == "match-case":
-				matchOption = true
-			case option == "script":
-				switch filepath.Ext(path) {
-				case ".js":
-					return active
-				default:
-					return !active
-				}
-			case option == "image":
-				switch filepath.Ext(path) {
-				case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".tiff", ".psd", ".raw", ".bmp", ".heif", ".indd", ".jpeg2000":
-					return active
-				default:
-					return !active
-				}
-			case option == "stylesheet":
-				switch filepath.Ext(path) {
-				case ".css":
-					return active
-				default:
-					return !active
-				}
-			case option == "font":
-				switch filepath.Ext(path) {
-				case ".otf", ".ttf", ".fnt":
-					return active
-				default:
-					return !active
-				}
-			}
-		}
+// isThirdParty compares the registrable domain of the request with the one of its page, see sourceHostname.
+// known is false when the request doesn't say who made it, then third-party options don't restrict the rule.
+func isThirdParty(req *Request) (thirdParty bool, known bool) {
+	source := sourceHostname(req)
+	if source == "" {
+		return false, false
+	}
+	return registrableDomain(req.URL.Hostname()) != registrableDomain(source), true
+}
+
+// registrableDomain returns the eTLD+1 of the hostname, or the hostname itself if it has none
+func registrableDomain(hostname string) string {
+	hostname = normalizeHostname(hostname)
+	if net.ParseIP(hostname) != nil {
+		return hostname
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
 	}
-	return matchOption
+	return domain
 }
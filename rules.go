@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 var (
@@ -17,6 +20,8 @@ var (
 	ErrEmptyLine = errors.New("Empty lines are skipped")
 	// ErrUnsupportedRule Unsupported option rules are skipped
 	ErrUnsupportedRule = errors.New("Unsupported option rules are skipped")
+	// ErrInvalidHTMLRule Malformed element hiding and scriptlet rules are skipped
+	ErrInvalidHTMLRule = errors.New("Malformed HTML rules are skipped")
 
 	// Except domain
 	supportedOptions = []string{
@@ -27,7 +32,49 @@ var (
 		"third-party",
 		"xmlhttprequest",
 		"match-case",
+		"subdocument",
+		"object",
+		"media",
+		"ping",
+		"websocket",
+		"webrtc",
+		"other",
+		"popup",
+		"document",
+		"xhr",
+		"css",
+		"frame",
+		"object-subrequest",
 	}
+	// Options that restrict the rule to some kind of request
+	typeOptions = map[string]ResourceType{
+		"image":          TypeImage,
+		"script":         TypeScript,
+		"stylesheet":     TypeStylesheet,
+		"font":           TypeFont,
+		"xmlhttprequest": TypeXMLHTTPRequest,
+		"subdocument":    TypeSubdocument,
+		"object":         TypeObject,
+		"media":          TypeMedia,
+		"ping":           TypePing,
+		"websocket":      TypeWebsocket,
+		"webrtc":         TypeWebRTC,
+		"other":          TypeOther,
+		"popup":          TypePopup,
+		"document":       TypeDocument,
+		// Short and legacy names
+		"xhr":               TypeXMLHTTPRequest,
+		"css":               TypeStylesheet,
+		"frame":             TypeSubdocument,
+		"object-subrequest": TypeObject,
+	}
+	// Separators of element hiding, CSS injection and scriptlet rules
+	htmlSeparators = []string{"##", "#@#", "#?#", "#@?#", "#$#", "#@$#", "#%#", "#@%#"}
+
+	pipeRegex = regexp.MustCompile(`(\|)[^$]`)
+	// End of the regex of a removeparam option, followed by its flags
+	removeParamRegexEnd = regexp.MustCompile(`/i?$`)
+
 	supportedOptionsPat = func() map[string]struct{} {
 		rv := map[string]struct{}{}
 		for _, key := range supportedOptions {
@@ -37,6 +84,21 @@ var (
 	}()
 )
 
+// UnsupportedOptionError is returned for rules having an option that can't be evaluated,
+// it is an ErrUnsupportedRule naming the option
+type UnsupportedOptionError struct {
+	Option string
+}
+
+func (err *UnsupportedOptionError) Error() string {
+	return ErrUnsupportedRule.Error() + ": " + err.Option
+}
+
+// Is makes errors.Is(err, ErrUnsupportedRule) true
+func (err *UnsupportedOptionError) Is(target error) bool {
+	return target == ErrUnsupportedRule
+}
+
 // Request has the expected data to be able to match the rules
 type Request struct {
 	// parsed full URL of the request
@@ -47,6 +109,12 @@ type Request struct {
 	Referer string
 	// Defines is request looks like XHLHttpRequest
 	IsXHR bool
+	// Kind of resource requested, guessed from IsXHR and the URL when unknown
+	ResourceType ResourceType
+	// URL of the page or frame the request is made for, nil when unknown.
+	// Page level exceptions, third-party and domain options are checked against it,
+	// the last two against the Origin or Referer when it is nil.
+	PageURL *url.URL
 }
 
 // RuleType type to identify the type of rule after parsing it
@@ -67,10 +135,53 @@ type RuleAdBlock struct {
 	IsException bool
 	Domains     map[string]bool
 	RuleType    RuleType
+	// Types the rule is restricted to, every type when empty, and the types it never applies to
+	Types         ResourceTypeMask
+	ExcludedTypes ResourceTypeMask
+	// Important blocking rules win over ordinary exceptions
+	Important bool
+	// BadFilter rules cancel the rules written the same way without the badfilter option
+	BadFilter bool
+	// Clients restricts the rule to DNS queries of some clients: IP addresses, CIDR ranges or names.
+	// Rules with clients only apply through MatchHostname.
+	Clients map[string]bool
+	// Redirect is the name of the resource served instead of the blocked request, ie: "noopjs".
+	// RedirectRule rules don't block, they only redirect requests blocked by another rule,
+	// as exceptions they disable the redirection to their resource, or to any resource when Redirect is empty.
+	Redirect         string
+	RedirectRule     bool
+	RedirectPriority int
+	// RemoveParam rules don't block, they remove query parameters from the URL, see RemoveParams.
+	// RemoveParamPattern is a parameter name, a "/regex/" tested against "name=value", either one
+	// prefixed with "~" to remove every other parameter, or empty to remove them all.
+	RemoveParam        bool
+	RemoveParamPattern string
+	// CSP rules don't block, they add the Content-Security-Policy CSPPolicy to the documents they match,
+	// as exceptions they disable the same policy, or every policy when CSPPolicy is empty
+	CSP       bool
+	CSPPolicy string
+	// Raw is the rule as it was written in the list
+	Raw string
+	// Source is the name of the list the rule was loaded from and Line its line number there
+	Source string
+	Line   int
+
+	// Rules read from a binary RuleSet compile their Regex on first use
+	regexSource string
+	// hosts rules come from a hosts file or a domain list, they have no Regex
+	hosts bool
+	// Compiled regex of a "/regex/" RemoveParamPattern
+	removeParamRegex *regexp.Regexp
+	compileOnce      sync.Once
 }
 
 // ParseRule parse and create a RuleAdBlock from the string
 func ParseRule(ruleText string) (*RuleAdBlock, error) {
+	return parseRule(ruleText, true)
+}
+
+// parseRule parses the rule, compiling its Regex right away or leaving it to the first match
+func parseRule(ruleText string, compile bool) (*RuleAdBlock, error) {
 	ruleText = strings.TrimSpace(ruleText)
 
 	if ruleText == "" {
@@ -81,12 +192,15 @@ func ParseRule(ruleText string) (*RuleAdBlock, error) {
 		return nil, ErrSkipComment
 	}
 
-	if strings.Contains(ruleText, "##") || strings.Contains(ruleText, "#@#") || strings.Contains(ruleText, "#?#") {
-		return nil, ErrSkipHTML
+	for _, separator := range htmlSeparators {
+		if strings.Contains(ruleText, separator) {
+			return nil, ErrSkipHTML
+		}
 	}
 
 	rule := &RuleAdBlock{
 		RuleText: ruleText,
+		Raw:      ruleText,
 		Domains:  map[string]bool{},
 		Options:  map[string]bool{},
 	}
@@ -100,31 +214,68 @@ func ParseRule(ruleText string) (*RuleAdBlock, error) {
 		parts := strings.SplitN(rule.RuleText, "$", 2)
 		rule.RuleText = parts[0]
 
-		for _, option := range strings.Split(parts[1], ",") {
+		for _, option := range splitOptions(parts[1]) {
 			optionNegative := !strings.HasPrefix(option, "~")
 			option = strings.TrimPrefix(option, "~")
 			_, supportedOption := supportedOptionsPat[option]
 
 			switch {
+			case option == "important" && optionNegative:
+				rule.Important = true
+			case option == "badfilter" && optionNegative:
+				rule.BadFilter = true
+			case (option == "elemhide" || option == "generichide" || option == "genericblock") && optionNegative && rule.IsException:
+				// Page level exceptions, they disable element hiding or generic blocking instead of allowing requests
+				rule.Options[option] = true
 			case strings.HasPrefix(option, "domain="):
 				for _, domain := range strings.Split(option[len("domain="):], "|") {
 					name := strings.TrimSpace(domain)
-					rule.Domains[strings.TrimPrefix(name, "~")] = !strings.HasPrefix(name, "~")
+					rule.Domains[normalizeHostname(strings.TrimPrefix(name, "~"))] = !strings.HasPrefix(name, "~")
+				}
+			case strings.HasPrefix(option, "client="):
+				rule.Clients = map[string]bool{}
+				for _, client := range strings.Split(option[len("client="):], "|") {
+					name := strings.TrimSpace(client)
+					rule.Clients[unquoteClient(strings.TrimPrefix(name, "~"))] = !strings.HasPrefix(name, "~")
+				}
+			case (option == "redirect" || option == "redirect-rule") && optionNegative && rule.IsException:
+				rule.RedirectRule = true
+			case strings.HasPrefix(option, "redirect=") || strings.HasPrefix(option, "redirect-rule="):
+				if err := parseRedirect(rule, option); err != nil {
+					return nil, err
+				}
+			case option == "removeparam" || strings.HasPrefix(option, "removeparam="):
+				if err := parseRemoveParam(rule, strings.TrimPrefix(option[len("removeparam"):], "=")); err != nil {
+					return nil, err
+				}
+			case option == "csp" && optionNegative && rule.IsException:
+				rule.CSP = true
+			case strings.HasPrefix(option, "csp="):
+				rule.CSP = true
+				rule.CSPPolicy = strings.TrimSpace(option[len("csp="):])
+				if rule.CSPPolicy == "" {
+					return nil, &UnsupportedOptionError{Option: option}
 				}
 			case !supportedOption:
-				return nil, ErrUnsupportedRule
+				return nil, &UnsupportedOptionError{Option: option}
 			default:
 				rule.Options[option] = optionNegative
+				if optionType, ok := typeOptions[option]; ok && optionNegative {
+					rule.Types |= optionType.Mask()
+				} else if ok {
+					rule.ExcludedTypes |= optionType.Mask()
+				}
 			}
 		}
 	}
 
+	rule.RuleText = normalizeRuleDomain(rule.RuleText)
 	rule.RuleType = AddressPart
 	if strings.HasPrefix(rule.RuleText, "||") && strings.HasSuffix(rule.RuleText, "^") {
 		rule.RuleType = DomainName
 	}
 
-	if strings.HasPrefix(rule.RuleText, "|") && strings.HasSuffix(rule.RuleText, "|") {
+	if len(rule.RuleText) > 1 && strings.HasPrefix(rule.RuleText, "|") && strings.HasSuffix(rule.RuleText, "|") {
 		rule.RuleType = ExactAddress
 	}
 
@@ -134,7 +285,11 @@ func ParseRule(ruleText string) (*RuleAdBlock, error) {
 		rule.RuleType = RegexRule
 	}
 
-	re, err := regexp.Compile(ruleToRegexp(rule))
+	rule.regexSource = ruleToRegexp(rule)
+	if !compile {
+		return rule, nil
+	}
+	re, err := regexp.Compile(rule.regexSource)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot compile Regex: %w", err)
 	}
@@ -142,53 +297,326 @@ func ParseRule(ruleText string) (*RuleAdBlock, error) {
 	return rule, nil
 }
 
-// RuleSet handle the structure to match whitelist and blacklist
+// splitOptions splits the options of a rule on commas. Commas escaped as "\\," and the ones inside
+// the regex of a "removeparam=/regex/" option, ie: "removeparam=/^x{1,3}$/", don't split options.
+func splitOptions(text string) []string {
+	options := []string{}
+	var option strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text) && text[i+1] == ',':
+			option.WriteByte(',')
+			i++
+		case text[i] == ',' && !inRemoveParamRegex(option.String()):
+			options = append(options, option.String())
+			option.Reset()
+		default:
+			option.WriteByte(text[i])
+		}
+	}
+	return append(options, option.String())
+}
+
+// inRemoveParamRegex reports whether the option is a removeparam regex not closed yet
+func inRemoveParamRegex(option string) bool {
+	if !strings.HasPrefix(option, "removeparam=") {
+		return false
+	}
+	value := strings.TrimPrefix(option[len("removeparam="):], "~")
+	return strings.HasPrefix(value, "/") && !removeParamRegexEnd.MatchString(value[1:])
+}
+
+// parseRedirect reads a "redirect=name:priority" or "redirect-rule=name" option
+func parseRedirect(rule *RuleAdBlock, option string) error {
+	parts := strings.SplitN(option, "=", 2)
+	name := parts[1]
+	if colon := strings.LastIndex(name, ":"); colon >= 0 {
+		priority, err := strconv.Atoi(name[colon+1:])
+		if err != nil {
+			return &UnsupportedOptionError{Option: option}
+		}
+		rule.RedirectPriority = priority
+		name = name[:colon]
+	}
+	resource, ok := LookupResource(name)
+	if !ok {
+		return &UnsupportedOptionError{Option: option}
+	}
+	rule.Redirect = resource.Name
+	rule.RedirectRule = parts[0] == "redirect-rule" || rule.IsException
+	return nil
+}
+
+// matchURL checks the URL against the rule Regex, compiling it first if needed
+func (rule *RuleAdBlock) matchURL(URL string) bool {
+	if rule.hosts {
+		return true
+	}
+	rule.compileOnce.Do(func() {
+		if rule.Regex == nil && rule.regexSource != "" {
+			rule.Regex, _ = regexp.Compile(rule.regexSource)
+		}
+	})
+	return rule.Regex != nil && rule.Regex.MatchString(URL)
+}
+
+// RuleSet handle the structure to match whitelist and blacklist.
+// Matching is safe from several goroutines, but adding rules isn't: build a new RuleSet
+// and swap it in through an AtomicRuleSet to reload rules while serving requests.
 type RuleSet struct {
-	white *matcher
-	black *matcher
+	white          *matcher
+	black          *matcher
+	importantWhite *matcher
+	importantBlack *matcher
+	// Normalized text of the rules cancelled by a badfilter rule
+	badFilters map[string]struct{}
+	cosmetic   *cosmeticMatcher
+	scriptlets *scriptletMatcher
+	// Exceptions disabling element hiding on the pages they match
+	elemHide    *matcher
+	genericHide *matcher
+	// Page level exceptions: $document ones allow every request made for the pages they match,
+	// $genericblock ones disable the generic blocking rules on them
+	documentExceptions *matcher
+	genericBlock       *matcher
+	// Redirect rules and the exceptions disabling them, they don't block or allow requests themselves
+	redirects          *matcher
+	redirectExceptions *matcher
+	// Rules removing query parameters and their exceptions
+	removeParams          *matcher
+	removeParamExceptions *matcher
+	// Rules adding a Content-Security-Policy to documents and their exceptions
+	csp           *matcher
+	cspExceptions *matcher
 }
 
-// AddRule Adds rule in the correct matcher
+// AddRule Adds rule in the correct matcher.
+// A badfilter rule removes the rules it cancels, whether they were added before or after it.
 func (ruleSet *RuleSet) AddRule(rule *RuleAdBlock) {
-	if !rule.IsException {
-		ruleSet.black.Add(rule)
+	key := rule.filterKey()
+	if rule.BadFilter {
+		ruleSet.badFilters[key] = struct{}{}
+		for _, m := range ruleSet.matchers() {
+			m.Remove(key)
+		}
+		return
 	}
-	if rule.IsException {
+	if _, ok := ruleSet.badFilters[key]; ok {
+		return
+	}
+
+	switch {
+	case rule.CSP && rule.IsException:
+		ruleSet.cspExceptions.Add(rule)
+	case rule.CSP:
+		ruleSet.csp.Add(rule)
+	case rule.RemoveParam && rule.IsException:
+		ruleSet.removeParamExceptions.Add(rule)
+	case rule.RemoveParam:
+		ruleSet.removeParams.Add(rule)
+	case rule.RedirectRule && rule.IsException:
+		ruleSet.redirectExceptions.Add(rule)
+	case rule.RedirectRule:
+		ruleSet.redirects.Add(rule)
+	case rule.IsException && rule.Options["document"]:
+		ruleSet.documentExceptions.Add(rule)
+	case rule.Options["elemhide"] || rule.Options["generichide"] || rule.Options["genericblock"]:
+		if rule.Options["elemhide"] {
+			ruleSet.elemHide.Add(rule)
+		}
+		if rule.Options["generichide"] {
+			ruleSet.genericHide.Add(rule)
+		}
+		if rule.Options["genericblock"] {
+			ruleSet.genericBlock.Add(rule)
+		}
+	case rule.IsException && rule.Important:
+		ruleSet.importantWhite.Add(rule)
+	case rule.IsException:
 		ruleSet.white.Add(rule)
+	case rule.Important:
+		ruleSet.importantBlack.Add(rule)
+	default:
+		ruleSet.black.Add(rule)
+	}
+}
+
+func (ruleSet *RuleSet) matchers() []*matcher {
+	return []*matcher{
+		ruleSet.white,
+		ruleSet.black,
+		ruleSet.importantWhite,
+		ruleSet.importantBlack,
+		ruleSet.elemHide,
+		ruleSet.genericHide,
+		ruleSet.redirects,
+		ruleSet.redirectExceptions,
+		ruleSet.removeParams,
+		ruleSet.removeParamExceptions,
+		ruleSet.csp,
+		ruleSet.cspExceptions,
+		ruleSet.documentExceptions,
+		ruleSet.genericBlock,
+	}
+}
+
+// Verdict is the decision taken by a RuleSet for a request
+type Verdict int
+
+const (
+	// NoMatch no blocking rule matched the request
+	NoMatch Verdict = iota
+	// Blocked a blocking rule matched and no exception applied
+	Blocked
+	// AllowedByException a blocking rule matched but an exception rule allowed the request
+	AllowedByException
+)
+
+// MatchResult explains the decision taken for a request
+type MatchResult struct {
+	Verdict Verdict
+	// Rule is the blocking rule that matched the request
+	Rule *RuleAdBlock
+	// Exception is the exception rule that allowed the request
+	Exception *RuleAdBlock
+	// Source is the list of the rule that decided the verdict
+	Source string
+	// Redirect is the name of the resource to serve instead of the blocked request, empty when there is none
+	Redirect string
+}
+
+// Match return the decision for the request along with the rules that took it.
+// Important blocking rules are only overridden by important exceptions.
+// The $document exceptions matching the page of the request allow it, the $genericblock
+// ones only keep the blocking rules restricted to some domains.
+func (ruleSet *RuleSet) Match(req *Request) *MatchResult {
+	result := &MatchResult{Verdict: NoMatch}
+	pages := pagesOf(req)
+	blocking := anyRule
+	if matchPages(ruleSet.genericBlock, pages, anyRule) != nil {
+		blocking = isSpecificRule
+	}
+
+	exceptions := []*matcher{ruleSet.importantWhite}
+	result.Rule = ruleSet.importantBlack.matchWhere(req, blocking)
+	important := result.Rule != nil
+	if !important {
+		exceptions = append(exceptions, ruleSet.white)
+		result.Rule = ruleSet.black.matchWhere(req, blocking)
+	}
+	if result.Rule == nil {
+		return result
 	}
+	result.Verdict = Blocked
+	result.Source = result.Rule.Source
+
+	for _, white := range exceptions {
+		result.Exception = white.Match(req)
+		if result.Exception != nil {
+			result.Verdict = AllowedByException
+			result.Source = result.Exception.Source
+			return result
+		}
+	}
+	documentException := anyRule
+	if important {
+		documentException = isImportantRule
+	}
+	if result.Exception = matchPages(ruleSet.documentExceptions, pages, documentException); result.Exception != nil {
+		result.Verdict = AllowedByException
+		result.Source = result.Exception.Source
+		return result
+	}
+	result.Redirect = ruleSet.redirect(req, result.Rule)
+	return result
+}
+
+// redirect returns the resource served instead of the blocked request, empty when it isn't redirected.
+// The redirect of the blocking rule and the matching redirect rules are tried by decreasing priority,
+// skipping the ones disabled by an exception.
+func (ruleSet *RuleSet) redirect(req *Request, blocking *RuleAdBlock) string {
+	candidates := ruleSet.redirects.MatchAll(req)
+	if blocking.Redirect != "" {
+		candidates = append([]*RuleAdBlock{blocking}, candidates...)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].RedirectPriority > candidates[j].RedirectPriority
+	})
+
+	exceptions := ruleSet.redirectExceptions.MatchAll(req)
+	for _, candidate := range candidates {
+		excepted := false
+		for _, exception := range exceptions {
+			if exception.Redirect == "" || exception.Redirect == candidate.Redirect {
+				excepted = true
+				break
+			}
+		}
+		if !excepted {
+			return candidate.Redirect
+		}
+	}
+	return ""
 }
 
 // Allow return of the current request is allowed to proceed or should be avoided
 func (ruleSet *RuleSet) Allow(req *Request) bool {
-	return ruleSet.white.Match(req) || !ruleSet.black.Match(req)
+	return ruleSet.Match(req).Verdict != Blocked
 }
 
 // CreateRuleSet Creates a fresh new empty RuleSet
 func CreateRuleSet() *RuleSet {
 	return &RuleSet{
-		white: &matcher{
-			addressPartMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-			domainNameMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-			exactAddressMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-		},
-		black: &matcher{
-			addressPartMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-			domainNameMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-			exactAddressMatcher: &pathMatcher{
-				next: map[rune]*pathMatcher{},
-			},
-		},
+		white:                 newMatcher(),
+		black:                 newMatcher(),
+		importantWhite:        newMatcher(),
+		importantBlack:        newMatcher(),
+		badFilters:            map[string]struct{}{},
+		cosmetic:              newCosmeticMatcher(),
+		scriptlets:            newScriptletMatcher(),
+		elemHide:              newMatcher(),
+		genericHide:           newMatcher(),
+		redirects:             newMatcher(),
+		redirectExceptions:    newMatcher(),
+		removeParams:          newMatcher(),
+		removeParamExceptions: newMatcher(),
+		csp:                   newMatcher(),
+		cspExceptions:         newMatcher(),
+		documentExceptions:    newMatcher(),
+		genericBlock:          newMatcher(),
+	}
+}
+
+// filterKey normalizes the rule text, without the badfilter option, so that rules
+// listing the same options in a different order share the same key
+func (rule *RuleAdBlock) filterKey() string {
+	if rule.hosts {
+		return rule.RuleText
+	}
+	parts := strings.SplitN(rule.Raw, "$", 2)
+	if len(parts) == 1 {
+		return rule.Raw
+	}
+	options := []string{}
+	for _, option := range splitOptions(parts[1]) {
+		switch {
+		case option == "badfilter":
+			continue
+		case strings.HasPrefix(option, "domain="):
+			domains := strings.Split(option[len("domain="):], "|")
+			sort.Strings(domains)
+			option = "domain=" + strings.Join(domains, "|")
+		}
+		options = append(options, option)
+	}
+	if len(options) == 0 {
+		return parts[0]
 	}
+	sort.Strings(options)
+	return parts[0] + "$" + strings.Join(options, ",")
 }
 
 func ruleToRegexp(r *RuleAdBlock) string {
@@ -233,7 +661,7 @@ func ruleToRegexp(r *RuleAdBlock) string {
 	}
 
 	// || in the beginning means beginning of the domain name
-	if rule[:2] == "||" {
+	if len(rule) >= 2 && rule[:2] == "||" {
 		// XXX: it is better to use urlparse for such things,
 		// but urlparse doesn't give us a single Regex.
 		// Regex is based on http://tools.ietf.org/html/rfc3986#appendix-B
@@ -254,6 +682,6 @@ func ruleToRegexp(r *RuleAdBlock) string {
 
 	// other | symbols should be escaped
 	// we have "|$" in our regexp - do not touch it
-	rule = regexp.MustCompile(`(\|)[^$]`).ReplaceAllString(rule, `\|`)
+	rule = pipeRegex.ReplaceAllString(rule, `\|`)
 	return rule
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,12 +29,7 @@ func newRuleSetFromList(rulesStr []string) (*RuleSet, error) {
 		rule, err := ParseRule(ruleStr)
 		switch {
 		case err == nil:
-			if !rule.IsException {
-				ruleSet.black.Add(rule)
-			}
-			if rule.IsException {
-				ruleSet.white.Add(rule)
-			}
+			ruleSet.AddRule(rule)
 		case errors.Is(err, ErrSkipComment),
 			errors.Is(err, ErrSkipHTML),
 			errors.Is(err, ErrUnsupportedRule),
@@ -62,7 +58,7 @@ func TestParsingHTMLRule(t *testing.T) {
 func TestParsingBadOptionRule(t *testing.T) {
 	ruleText := "||domain.net^$badoption"
 	_, err := ParseRule(ruleText)
-	assert.EqualError(t, err, "Unsupported option rules are skipped")
+	assert.EqualError(t, err, "Unsupported option rules are skipped: badoption")
 }
 
 func TestCommentRule(t *testing.T) {
@@ -98,7 +94,7 @@ func TestBadOptionRule(t *testing.T) {
 	ruleText := "||domain.net^$badoption"
 	rules := []string{ruleText}
 	_, err := newRuleSetFromList(rules)
-	assert.EqualError(t, err, "Unsupported option rules are skipped: ||domain.net^$badoption")
+	assert.EqualError(t, err, "Unsupported option rules are skipped: badoption: ||domain.net^$badoption")
 }
 
 func TestExceptionRule(t *testing.T) {
@@ -438,3 +434,388 @@ func TestRegexLooksLikePath(t *testing.T) {
 	rule, _ := ParseRule(ruleText)
 	assert.Equal(t, rule.RuleType, RegexRule)
 }
+
+func TestRuleWithThirdPartyOption(t *testing.T) {
+	rules := []string{"||tracker.com^$third-party"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	req := reqFromURL("http://tracker.com/pixel.gif")
+	req.Referer = "http://news.example.com/article"
+	assert.False(t, ruleSet.Allow(req))
+
+	req = reqFromURL("http://cdn.tracker.com/pixel.gif")
+	req.Origin = "https://www.tracker.com"
+	assert.True(t, ruleSet.Allow(req))
+
+	// Unknown requester doesn't restrict the rule
+	assert.False(t, ruleSet.Allow(reqFromURL("http://tracker.com/pixel.gif")))
+}
+
+func TestRuleWithFirstPartyOption(t *testing.T) {
+	rules := []string{"||example.co.uk^$~third-party"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	req := reqFromURL("http://static.example.co.uk/ads.js")
+	req.Referer = "http://www.example.co.uk/"
+	assert.False(t, ruleSet.Allow(req))
+
+	req = reqFromURL("http://static.example.co.uk/ads.js")
+	req.Referer = "http://other.co.uk/"
+	assert.True(t, ruleSet.Allow(req))
+}
+
+func TestRuleWithXHROption(t *testing.T) {
+	rules := []string{"||api.example.com^$xmlhttprequest"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	req := reqFromURL("http://api.example.com/track.js")
+	req.IsXHR = true
+	assert.False(t, ruleSet.Allow(req))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://api.example.com/track.js")))
+
+	rules = []string{"||api.example.com^$~xmlhttprequest"}
+	ruleSet, err = newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	req = reqFromURL("http://api.example.com/track")
+	req.IsXHR = true
+	assert.True(t, ruleSet.Allow(req))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://api.example.com/track")))
+}
+
+func TestRuleWithXHRAndScriptOptions(t *testing.T) {
+	rules := []string{"||api.example.com^$script,xmlhttprequest"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	req := reqFromURL("http://api.example.com/data")
+	req.IsXHR = true
+	assert.False(t, ruleSet.Allow(req))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://api.example.com/file.js")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://api.example.com/file.css")))
+
+	rules = []string{"||api.example.com^$~script,~xmlhttprequest"}
+	ruleSet, err = newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	req = reqFromURL("http://api.example.com/data")
+	req.IsXHR = true
+	assert.True(t, ruleSet.Allow(req))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://api.example.com/file.js")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://api.example.com/file.css")))
+}
+
+func TestRuleWithExplicitResourceType(t *testing.T) {
+	rules := []string{"||cdn.example.com^$image"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	req := reqFromURL("http://cdn.example.com/api/pixel?id=1")
+	assert.True(t, ruleSet.Allow(req))
+	req.ResourceType = TypeImage
+	assert.False(t, ruleSet.Allow(req))
+
+	// The explicit type wins over the extension
+	req = reqFromURL("http://cdn.example.com/banner.png")
+	req.ResourceType = TypeScript
+	assert.True(t, ruleSet.Allow(req))
+
+	assert.False(t, ruleSet.Allow(reqFromURL("http://cdn.example.com/logo.svg")))
+}
+
+func TestResourceTypeNames(t *testing.T) {
+	resourceType, ok := ParseResourceType("xmlhttprequest")
+	assert.True(t, ok)
+	assert.Equal(t, TypeXMLHTTPRequest, resourceType)
+	assert.Equal(t, "subdocument", TypeSubdocument.String())
+
+	_, ok = ParseResourceType("unknown")
+	assert.False(t, ok)
+}
+
+func TestRuleSetMatchResult(t *testing.T) {
+	ruleSet := CreateRuleSet()
+	_, err := ruleSet.AddList("easylist", strings.NewReader("! comment\n||ads.example.com^\n"))
+	assert.NoError(t, err)
+	_, err = ruleSet.AddList("custom", strings.NewReader("@@||ads.example.com^$script"))
+	assert.NoError(t, err)
+
+	result := ruleSet.Match(reqFromURL("http://example.com/"))
+	assert.Equal(t, NoMatch, result.Verdict)
+	assert.Nil(t, result.Rule)
+
+	result = ruleSet.Match(reqFromURL("http://ads.example.com/banner.gif"))
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.Equal(t, "||ads.example.com^", result.Rule.Raw)
+	assert.Equal(t, 2, result.Rule.Line)
+	assert.Equal(t, "easylist", result.Source)
+	assert.Nil(t, result.Exception)
+
+	result = ruleSet.Match(reqFromURL("http://ads.example.com/file.js"))
+	assert.Equal(t, AllowedByException, result.Verdict)
+	assert.Equal(t, "||ads.example.com^", result.Rule.Raw)
+	assert.Equal(t, "@@||ads.example.com^$script", result.Exception.Raw)
+	assert.Equal(t, "custom", result.Source)
+}
+
+func TestImportantRuleOverridesException(t *testing.T) {
+	rules := []string{
+		"||tracker.example.com^$important",
+		"||ads.example.com^",
+		"@@||example.com^",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://tracker.example.com/")))
+
+	result := ruleSet.Match(reqFromURL("http://tracker.example.com/"))
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.True(t, result.Rule.Important)
+}
+
+func TestImportantException(t *testing.T) {
+	rules := []string{
+		"||tracker.example.com^$important",
+		"@@||tracker.example.com^$important,script",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://tracker.example.com/pixel.gif")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://tracker.example.com/file.js")))
+
+	// Important exceptions also override ordinary rules
+	rules = []string{"/banner/*/img^", "@@/banner/*/img^$important"}
+	ruleSet, err = newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/banner/foo/img")))
+}
+
+func TestBadFilterCancelsRule(t *testing.T) {
+	rules := []string{"||ads.example.com^$script,domain=example.com|~b.example.com"}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/file.js")))
+
+	rules = []string{
+		"||ads.example.com^$script,domain=example.com|~b.example.com",
+		"||ads.example.com^$domain=~b.example.com|example.com,script,badfilter",
+		"||tracker.example.com^",
+	}
+	ruleSet, err = newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/file.js")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://tracker.example.com/")))
+
+	// Order doesn't matter
+	rules = []string{"||tracker.example.com^$badfilter", "||tracker.example.com^", "/banner/*/img^$badfilter", "/banner/*/img^"}
+	ruleSet, err = newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.True(t, ruleSet.Allow(reqFromURL("http://tracker.example.com/")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/banner/foo/img")))
+}
+
+func TestBadFilterOnlyCancelsSameRule(t *testing.T) {
+	rules := []string{
+		"||ads.example.com^",
+		"@@||ads.example.com^",
+		"@@||ads.example.com^$badfilter",
+		"||ads.example.com^$script,badfilter",
+		"/ads\\d/",
+		"/ads\\d/$badfilter",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+	assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/ads1")))
+}
+
+func TestParsingRedirectRule(t *testing.T) {
+	rule, err := ParseRule("||ads.example.com^$script,redirect=noop.js:10")
+	assert.NoError(t, err)
+	assert.Equal(t, "noopjs", rule.Redirect)
+	assert.Equal(t, 10, rule.RedirectPriority)
+	assert.False(t, rule.RedirectRule)
+
+	rule, err = ParseRule("||ads.example.com^$image,redirect-rule=1x1-transparent.gif")
+	assert.NoError(t, err)
+	assert.Equal(t, "1x1.gif", rule.Redirect)
+	assert.True(t, rule.RedirectRule)
+
+	rule, err = ParseRule("@@||ads.example.com^$redirect-rule")
+	assert.NoError(t, err)
+	assert.True(t, rule.RedirectRule)
+	assert.Equal(t, "", rule.Redirect)
+
+	_, err = ParseRule("||ads.example.com^$redirect=unknown-resource")
+	assert.True(t, errors.Is(err, ErrUnsupportedRule))
+	var optionErr *UnsupportedOptionError
+	assert.True(t, errors.As(err, &optionErr))
+	assert.Equal(t, "redirect=unknown-resource", optionErr.Option)
+	_, err = ParseRule("||ads.example.com^$redirect-rule=noopjs:high")
+	assert.True(t, errors.As(err, &optionErr))
+	assert.Equal(t, "redirect-rule=noopjs:high", optionErr.Option)
+	_, err = ParseRule("||ads.example.com^$redirect-rule")
+	assert.True(t, errors.Is(err, ErrUnsupportedRule))
+}
+
+func TestRedirectRule(t *testing.T) {
+	rules := []string{
+		"||ads.example.com^$script,redirect=noopjs",
+		"||tracker.example.com^$script",
+		"||tracker.example.com^$script,redirect-rule=google-analytics_analytics.js",
+		"||tracker.example.com^$script,redirect-rule=noopjs:5",
+		"@@||tracker.example.com^$script,redirect-rule=noopjs",
+		"||cdn.example.com^$redirect-rule=noopjs",
+		"||pixel.example.com^$image,redirect=1x1.gif",
+		"@@||pixel.example.com^$redirect",
+		"||banner.example.com^$image,redirect=2x2.png",
+		"@@||banner.example.com^$image",
+	}
+	ruleSet, err := newRuleSetFromList(rules)
+	assert.NoError(t, err)
+
+	result := ruleSet.Match(reqFromURL("http://ads.example.com/ad.js"))
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.Equal(t, "noopjs", result.Redirect)
+
+	// The exception skips the highest priority redirect
+	result = ruleSet.Match(reqFromURL("http://tracker.example.com/analytics.js"))
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.Equal(t, "google-analytics_analytics.js", result.Redirect)
+
+	// Redirect rules alone don't block
+	result = ruleSet.Match(reqFromURL("http://cdn.example.com/lib.js"))
+	assert.Equal(t, NoMatch, result.Verdict)
+	assert.Equal(t, "", result.Redirect)
+
+	// Redirect exceptions don't allow the request
+	result = ruleSet.Match(reqFromURL("http://pixel.example.com/p.gif"))
+	assert.Equal(t, Blocked, result.Verdict)
+	assert.Equal(t, "", result.Redirect)
+
+	result = ruleSet.Match(reqFromURL("http://banner.example.com/b.png"))
+	assert.Equal(t, AllowedByException, result.Verdict)
+	assert.Equal(t, "", result.Redirect)
+}
+
+func TestLookupResource(t *testing.T) {
+	resource, ok := LookupResource("1x1-transparent.gif")
+	assert.True(t, ok)
+	assert.Equal(t, "1x1.gif", resource.Name)
+	assert.Equal(t, "image/gif", resource.ContentType)
+	assert.Equal(t, "GIF89a", string(resource.Body[:6]))
+
+	resource, ok = LookupResource("noopjs")
+	assert.True(t, ok)
+	assert.Equal(t, "application/javascript", resource.ContentType)
+
+	_, ok = LookupResource("missing")
+	assert.False(t, ok)
+}
+
+func TestRuleTypeMask(t *testing.T) {
+	rule, err := ParseRule("||ads.example.com^$script,image,~xmlhttprequest")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeScript.Mask()|TypeImage.Mask(), rule.Types)
+	assert.Equal(t, TypeXMLHTTPRequest.Mask(), rule.ExcludedTypes)
+	assert.True(t, rule.Types.Has(TypeImage))
+	assert.False(t, rule.Types.Has(TypeFont))
+}
+
+func TestRuleWithSeveralTypeOptions(t *testing.T) {
+	// Evaluated many times as map iteration order changes from one run to the other
+	for i := 0; i < 50; i++ {
+		ruleSet, err := newRuleSetFromList([]string{"||ads.example.com^$script,image,stylesheet", "/track\\d+/$image,~script"})
+		assert.NoError(t, err)
+		assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/a.js")))
+		assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/a.gif")))
+		assert.False(t, ruleSet.Allow(reqFromURL("http://ads.example.com/a.css")))
+		assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/a.woff")))
+		assert.True(t, ruleSet.Allow(reqFromURL("http://ads.example.com/")))
+
+		// Regex rules check their options too
+		assert.False(t, ruleSet.Allow(reqFromURL("http://example.com/track1.gif")))
+		assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/track1.js")))
+		assert.True(t, ruleSet.Allow(reqFromURL("http://example.com/track1.html")))
+	}
+}
+
+func TestRuleWithOtherTypeOptions(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{
+		"/frames/*$subdocument",
+		"/player/*$object,media",
+		"/beacon/*$ping",
+		"/socket/*$websocket,webrtc",
+		"/popunder/*$popup",
+		"/landing/*$document",
+		"/misc/*$other",
+		"/any/*$~document,~popup",
+		"/short/*$xhr,css,frame",
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		url          string
+		resourceType ResourceType
+		allowed      bool
+	}{
+		{"http://example.com/frames/ad.html", TypeSubdocument, false},
+		{"http://example.com/frames/ad.html", TypeDocument, true},
+		{"http://example.com/player/ad.swf", TypeObject, false},
+		{"http://example.com/player/ad.mp4", TypeUnknown, false},
+		{"http://example.com/player/ad.mp4", TypeScript, true},
+		{"http://example.com/beacon/hit", TypePing, false},
+		{"http://example.com/beacon/hit", TypeXMLHTTPRequest, true},
+		{"http://example.com/socket/live", TypeWebsocket, false},
+		{"http://example.com/socket/live", TypeWebRTC, false},
+		{"http://example.com/socket/live", TypeOther, true},
+		{"http://example.com/popunder/offer", TypePopup, false},
+		{"http://example.com/popunder/offer", TypeUnknown, true},
+		{"http://example.com/landing/offer", TypeDocument, false},
+		{"http://example.com/landing/offer", TypeImage, true},
+		{"http://example.com/misc/data", TypeUnknown, false},
+		{"http://example.com/misc/data.js", TypeUnknown, true},
+		{"http://example.com/any/ad.js", TypeScript, false},
+		{"http://example.com/any/ad.html", TypeDocument, true},
+		{"http://example.com/any/ad.html", TypePopup, true},
+		{"http://example.com/short/ad.css", TypeUnknown, false},
+		{"http://example.com/short/ad.html", TypeSubdocument, false},
+		{"http://example.com/short/ad.js", TypeScript, true},
+	}
+	for _, test := range tests {
+		req := reqFromURL(test.url)
+		req.ResourceType = test.resourceType
+		assert.Equal(t, test.allowed, ruleSet.Allow(req), "%s as %s", test.url, test.resourceType)
+	}
+}
+
+func TestUnsupportedOptionIsNamed(t *testing.T) {
+	_, err := ParseRule("||ads.example.com^$rewrite=abp-resource:blank-js")
+	assert.True(t, errors.Is(err, ErrUnsupportedRule))
+	var optionErr *UnsupportedOptionError
+	assert.True(t, errors.As(err, &optionErr))
+	assert.Equal(t, "rewrite=abp-resource:blank-js", optionErr.Option)
+}
+
+func TestPopupNeedsExplicitOption(t *testing.T) {
+	ruleSet, err := newRuleSetFromList([]string{
+		"||example.org^",
+		"||pop.com^$~script",
+		"||popunder.net^$popup",
+	})
+	assert.NoError(t, err)
+
+	popup := func(rawURL string) *Request {
+		req := reqFromURL(rawURL)
+		req.ResourceType = TypePopup
+		return req
+	}
+	assert.True(t, ruleSet.Allow(popup("http://example.org/")))
+	assert.True(t, ruleSet.Allow(popup("http://pop.com/")))
+	assert.False(t, ruleSet.Allow(popup("http://popunder.net/offer")))
+
+	// The other types keep matching the rules without $popup
+	assert.False(t, ruleSet.Allow(reqFromURL("http://example.org/")))
+	assert.False(t, ruleSet.Allow(reqFromURL("http://pop.com/a.gif")))
+	assert.True(t, ruleSet.Allow(reqFromURL("http://popunder.net/offer")))
+}
@@ -0,0 +1,249 @@
+package adblockgoparser
+
+import (
+	"strings"
+)
+
+// ScriptletRule injects the scriptlet Name, called with Args, in the pages of its Domains
+type ScriptletRule struct {
+	// Name of the scriptlet without the ".js" suffix uBlock Origin accepts, ie: "set-constant"
+	Name string
+	Args []string
+	// Domains the rule applies on, like for a CosmeticRule
+	Domains map[string]bool
+	// IsException rules disable the scriptlet with the same name and arguments,
+	// or every scriptlet when Name is empty
+	IsException bool
+	// Raw is the rule as it was written in the list
+	Raw string
+	// Source is the name of the list the rule was loaded from and Line its line number there
+	Source string
+	Line   int
+}
+
+// ParseScriptletRule parse and create a ScriptletRule from a uBlock Origin rule, ie:
+// "example.com##+js(set-constant, ads, true)", or an AdGuard one, ie:
+// "example.com#%#//scriptlet('set-constant', 'ads', 'true')"
+func ParseScriptletRule(ruleText string) (*ScriptletRule, error) {
+	ruleText = strings.TrimSpace(ruleText)
+	if ruleText == "" {
+		return nil, ErrEmptyLine
+	}
+	if strings.HasPrefix(ruleText, "!") || strings.HasPrefix(ruleText, "[Adblock") {
+		return nil, ErrSkipComment
+	}
+
+	domains, separator, body := splitCosmeticRule(ruleText)
+	body = strings.TrimSpace(body)
+	var name string
+	var args []string
+	var err error
+	switch {
+	case (separator == "##" || separator == "#@#") && strings.HasPrefix(body, "+js(") && strings.HasSuffix(body, ")"):
+		name, args = splitUBOScriptlet(body[len("+js(") : len(body)-1])
+	case (separator == "#%#" || separator == "#@%#") && strings.HasPrefix(body, "//scriptlet(") && strings.HasSuffix(body, ")"):
+		name, args, err = splitAdGuardScriptlet(body[len("//scriptlet(") : len(body)-1])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrSkipHTML
+	}
+
+	rule := &ScriptletRule{
+		Name:        strings.TrimSuffix(name, ".js"),
+		Args:        args,
+		Domains:     map[string]bool{},
+		IsException: strings.HasPrefix(separator, "#@"),
+		Raw:         ruleText,
+	}
+	if rule.Name == "" && !rule.IsException {
+		return nil, ErrInvalidHTMLRule
+	}
+	if domains != "" {
+		for _, domain := range strings.Split(domains, ",") {
+			name := strings.TrimSpace(domain)
+			if name == "" || name == "~" || strings.ContainsAny(name, "/^*|$") {
+				return nil, ErrInvalidHTMLRule
+			}
+			rule.Domains[normalizeHostname(strings.TrimPrefix(name, "~"))] = !strings.HasPrefix(name, "~")
+		}
+	}
+	return rule, nil
+}
+
+// splitUBOScriptlet splits "name, arg1, arg2" where commas inside arguments are escaped as "\,"
+func splitUBOScriptlet(call string) (string, []string) {
+	parts := []string{}
+	var current strings.Builder
+	for i := 0; i < len(call); i++ {
+		switch {
+		case call[i] == '\\' && i+1 < len(call) && call[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case call[i] == ',':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(call[i])
+		}
+	}
+	parts = append(parts, strings.TrimSpace(current.String()))
+	for i, part := range parts {
+		parts[i] = unquote(part)
+	}
+	return parts[0], parts[1:]
+}
+
+// splitAdGuardScriptlet splits "'name', 'arg1', 'arg2'" where every value is quoted
+func splitAdGuardScriptlet(call string) (string, []string, error) {
+	parts := []string{}
+	call = strings.TrimSpace(call)
+	for call != "" {
+		quote := call[0]
+		if quote != '\'' && quote != '"' {
+			return "", nil, ErrInvalidHTMLRule
+		}
+		var value strings.Builder
+		end := -1
+		for i := 1; i < len(call); i++ {
+			if call[i] == '\\' && i+1 < len(call) {
+				i++
+				value.WriteByte(call[i])
+				continue
+			}
+			if call[i] == quote {
+				end = i
+				break
+			}
+			value.WriteByte(call[i])
+		}
+		if end < 0 {
+			return "", nil, ErrInvalidHTMLRule
+		}
+		parts = append(parts, value.String())
+		call = strings.TrimSpace(call[end+1:])
+		if call != "" {
+			if call[0] != ',' {
+				return "", nil, ErrInvalidHTMLRule
+			}
+			call = strings.TrimSpace(call[1:])
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	return parts[0], parts[1:], nil
+}
+
+// unquote removes the quotes uBlock Origin allows around arguments
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// key identifies the scriptlet call, exceptions disable the rules sharing their key
+func (rule *ScriptletRule) key() string {
+	return rule.Name + "(" + strings.Join(rule.Args, ", ") + ")"
+}
+
+// scriptletMatcher indexes scriptlet rules by the domains they apply on
+type scriptletMatcher struct {
+	// Every rule in the order they were added
+	rules    []*ScriptletRule
+	generic  []*ScriptletRule
+	byDomain map[string][]*ScriptletRule
+	// Exceptions indexed by the call they disable, "" for the ones disabling every scriptlet
+	exceptions map[string][]*ScriptletRule
+}
+
+func newScriptletMatcher() *scriptletMatcher {
+	return &scriptletMatcher{
+		byDomain:   map[string][]*ScriptletRule{},
+		exceptions: map[string][]*ScriptletRule{},
+	}
+}
+
+// Add Rule indexed by its domains, or by its call for exceptions
+func (sm *scriptletMatcher) Add(rule *ScriptletRule) {
+	sm.rules = append(sm.rules, rule)
+	switch {
+	case rule.IsException && rule.Name == "":
+		sm.exceptions[""] = append(sm.exceptions[""], rule)
+	case rule.IsException:
+		sm.exceptions[rule.key()] = append(sm.exceptions[rule.key()], rule)
+	default:
+		generic := true
+		for domain, active := range rule.Domains {
+			if active {
+				generic = false
+				sm.byDomain[domain] = append(sm.byDomain[domain], rule)
+			}
+		}
+		if generic {
+			sm.generic = append(sm.generic, rule)
+		}
+	}
+}
+
+// Match returns the scriptlets to inject on the hostname without the ones disabled by an exception
+func (sm *scriptletMatcher) Match(hostname string) []*ScriptletRule {
+	hostname = normalizeHostname(hostname)
+	for _, exception := range sm.exceptions[""] {
+		if domainsMatch(exception.Domains, hostname) {
+			return []*ScriptletRule{}
+		}
+	}
+
+	candidates := append([]*ScriptletRule{}, sm.generic...)
+	for _, domain := range hostnameSuffixes(hostname) {
+		candidates = append(candidates, sm.byDomain[domain]...)
+	}
+
+	rules := []*ScriptletRule{}
+	seen := map[*ScriptletRule]struct{}{}
+	for _, rule := range candidates {
+		if _, ok := seen[rule]; ok {
+			continue
+		}
+		seen[rule] = struct{}{}
+		if domainsMatch(rule.Domains, hostname) && !sm.excepted(rule, hostname) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (sm *scriptletMatcher) excepted(rule *ScriptletRule, hostname string) bool {
+	for _, exception := range sm.exceptions[rule.key()] {
+		if domainsMatch(exception.Domains, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddScriptletRule Adds a scriptlet injection rule
+func (ruleSet *RuleSet) AddScriptletRule(rule *ScriptletRule) {
+	ruleSet.scriptlets.Add(rule)
+}
+
+// Scriptlets returns the scriptlets to inject in the pages of the hostname, exceptions already subtracted
+func (ruleSet *RuleSet) Scriptlets(hostname string) []*ScriptletRule {
+	return ruleSet.scriptlets.Match(hostname)
+}
+
+// isScriptletRule reports whether the HTML rule injects a scriptlet rather than hiding elements
+func isScriptletRule(ruleText string) bool {
+	_, separator, body := splitCosmeticRule(strings.TrimSpace(ruleText))
+	body = strings.TrimSpace(body)
+	switch separator {
+	case "##", "#@#":
+		return strings.HasPrefix(body, "+js(")
+	case "#%#", "#@%#":
+		return true
+	}
+	return false
+}
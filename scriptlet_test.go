@@ -0,0 +1,77 @@
+package adblockgoparser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScriptletRule(t *testing.T) {
+	rule, err := ParseScriptletRule("example.com,~Sub.Example.com##+js(set-constant.js, ads, true)")
+	assert.NoError(t, err)
+	assert.Equal(t, "set-constant", rule.Name)
+	assert.Equal(t, []string{"ads", "true"}, rule.Args)
+	assert.Equal(t, map[string]bool{"example.com": true, "sub.example.com": false}, rule.Domains)
+	assert.False(t, rule.IsException)
+
+	rule, err = ParseScriptletRule(`example.com##+js(abort-on-property-read, "a\,b")`)
+	assert.NoError(t, err)
+	assert.Equal(t, "abort-on-property-read", rule.Name)
+	assert.Equal(t, []string{"a,b"}, rule.Args)
+
+	rule, err = ParseScriptletRule(`example.org#%#//scriptlet('set-constant', 'it\'s', "false")`)
+	assert.NoError(t, err)
+	assert.Equal(t, "set-constant", rule.Name)
+	assert.Equal(t, []string{"it's", "false"}, rule.Args)
+
+	rule, err = ParseScriptletRule("example.com#@#+js()")
+	assert.NoError(t, err)
+	assert.True(t, rule.IsException)
+	assert.Equal(t, "", rule.Name)
+
+	rule, err = ParseScriptletRule("example.org#@%#//scriptlet('set-constant', 'ads', 'true')")
+	assert.NoError(t, err)
+	assert.True(t, rule.IsException)
+
+	_, err = ParseScriptletRule("example.com##.banner")
+	assert.Equal(t, ErrSkipHTML, err)
+	_, err = ParseScriptletRule("example.com#%#window.ads = true;")
+	assert.Equal(t, ErrSkipHTML, err)
+	_, err = ParseScriptletRule("example.com#%#//scriptlet(set-constant)")
+	assert.Equal(t, ErrInvalidHTMLRule, err)
+	_, err = ParseScriptletRule("example.com##+js()")
+	assert.Equal(t, ErrInvalidHTMLRule, err)
+}
+
+func TestScriptlets(t *testing.T) {
+	list := strings.Join([]string{
+		"example.com##+js(set-constant, ads, true)",
+		"example.com##+js(abort-on-property-read, adblock)",
+		"~news.example.com##+js(nowebrtc)",
+		"shop.example.com#@#+js(set-constant, ads, true)",
+		"clean.example.com#@#+js()",
+		"example.com##.banner",
+	}, "\n")
+	ruleSet, report, err := NewRuleSetFromReader(strings.NewReader(list))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, report.Scriptlets)
+	assert.Equal(t, 1, report.Cosmetic)
+
+	names := func(hostname string) []string {
+		names := []string{}
+		for _, rule := range ruleSet.Scriptlets(hostname) {
+			names = append(names, rule.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"nowebrtc", "set-constant", "abort-on-property-read"}, names("www.example.com"))
+	assert.Equal(t, []string{"set-constant", "abort-on-property-read"}, names("news.example.com"))
+	assert.Equal(t, []string{"nowebrtc", "abort-on-property-read"}, names("shop.example.com"))
+	assert.Empty(t, names("clean.example.com"))
+	assert.Equal(t, []string{"nowebrtc"}, names("other.org"))
+
+	rule := ruleSet.Scriptlets("example.com")[1]
+	assert.Equal(t, []string{"ads", "true"}, rule.Args)
+	assert.Equal(t, 1, rule.Line)
+}
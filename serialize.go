@@ -0,0 +1,472 @@
+package adblockgoparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Binary format of a compiled RuleSet:
+//
+//	magic "ABGP", format version
+//	list sources, then the rules as kind, raw text, source index and line,
+//	followed by the domain for the rules read from a hosts file, or by the parsed
+//	fields of filter rules: rule text, regex source, rule type, flags, type masks,
+//	options, domains, clients, redirect, removeparam and csp values
+//	the normalized text of the badfilter rules
+//	for each matcher the address part, domain name and exact address tries
+//	followed by the regex rules, rules are referenced by their index
+//	the element hiding rules as raw text, source index and line
+//	the scriptlet rules as raw text, source index and line
+//
+// Numbers are uvarints, strings are prefixed by their length and string sets are
+// their sorted keys, each followed by its boolean value.
+const (
+	binaryMagic   = "ABGP"
+	binaryVersion = 10
+
+	// Kinds of rule stored in the binary format
+	binaryFilterRule = 0
+	binaryHostsRule  = 1
+
+	// Flags of the filter rules
+	binaryException    = 1 << 0
+	binaryImportant    = 1 << 1
+	binaryRedirectRule = 1 << 2
+	binaryRemoveParam  = 1 << 3
+	binaryCSP          = 1 << 4
+)
+
+var (
+	// ErrInvalidBinary The data isn't a binary RuleSet
+	ErrInvalidBinary = errors.New("Invalid binary RuleSet")
+	// ErrBinaryVersion The binary RuleSet was written with another format version
+	ErrBinaryVersion = errors.New("Unsupported binary RuleSet version")
+)
+
+// MarshalBinary encodes the compiled RuleSet, tries included, to be loaded back with UnmarshalBinary
+func (ruleSet *RuleSet) MarshalBinary() ([]byte, error) {
+	enc := &encoder{
+		rules:   map[*RuleAdBlock]int{},
+		sources: map[string]int{},
+	}
+	matchers := ruleSet.matchers()
+	for _, m := range matchers {
+		enc.collect(m)
+	}
+
+	enc.buf.WriteString(binaryMagic)
+	enc.uint(binaryVersion)
+	for _, rule := range ruleSet.cosmetic.rules {
+		enc.source(rule.Source)
+	}
+	for _, rule := range ruleSet.scriptlets.rules {
+		enc.source(rule.Source)
+	}
+	enc.uint(len(enc.sourceList))
+	for _, source := range enc.sourceList {
+		enc.string(source)
+	}
+	enc.uint(len(enc.ruleList))
+	for _, rule := range enc.ruleList {
+		if rule.Raw == "" {
+			return nil, fmt.Errorf("Cannot encode rule %q: only parsed rules can be encoded", rule.RuleText)
+		}
+		kind := binaryFilterRule
+		if rule.hosts {
+			kind = binaryHostsRule
+		}
+		enc.uint(kind)
+		enc.string(rule.Raw)
+		enc.uint(enc.sources[rule.Source])
+		enc.uint(rule.Line)
+		if rule.hosts {
+			enc.string(rule.RuleText[2 : len(rule.RuleText)-1])
+		} else {
+			enc.filterRule(rule)
+		}
+	}
+
+	badFilters := make([]string, 0, len(ruleSet.badFilters))
+	for key := range ruleSet.badFilters {
+		badFilters = append(badFilters, key)
+	}
+	sort.Strings(badFilters)
+	enc.uint(len(badFilters))
+	for _, key := range badFilters {
+		enc.string(key)
+	}
+
+	for _, m := range matchers {
+		enc.pathMatcher(m.addressPartMatcher)
+		enc.pathMatcher(m.domainNameMatcher)
+		enc.pathMatcher(m.exactAddressMatcher)
+		enc.ruleRefs(m.regexpRules)
+	}
+
+	enc.uint(len(ruleSet.cosmetic.rules))
+	for _, rule := range ruleSet.cosmetic.rules {
+		enc.string(rule.Raw)
+		enc.uint(enc.sources[rule.Source])
+		enc.uint(rule.Line)
+	}
+	enc.uint(len(ruleSet.scriptlets.rules))
+	for _, rule := range ruleSet.scriptlets.rules {
+		enc.string(rule.Raw)
+		enc.uint(enc.sources[rule.Source])
+		enc.uint(rule.Line)
+	}
+	return enc.buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the rules of the RuleSet with the ones encoded by MarshalBinary.
+// Filter rules aren't parsed again and their regexes aren't compiled until the rule is first
+// matched against a request, only removeparam regexes are compiled while loading.
+func (ruleSet *RuleSet) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return ErrInvalidBinary
+	}
+	dec := &decoder{data: data[len(binaryMagic):]}
+	if version := dec.uint(); dec.err == nil && version != binaryVersion {
+		return fmt.Errorf("%w: %d", ErrBinaryVersion, version)
+	}
+
+	sources := make([]string, dec.count())
+	for i := range sources {
+		sources[i] = dec.string()
+	}
+	dec.rules = make([]*RuleAdBlock, dec.count())
+	for i := range dec.rules {
+		kind, raw, source, line := dec.uint(), dec.string(), dec.uint(), dec.uint()
+		if dec.err != nil {
+			return dec.err
+		}
+		if source >= len(sources) {
+			return ErrInvalidBinary
+		}
+		var rule *RuleAdBlock
+		switch kind {
+		case binaryFilterRule:
+			var err error
+			rule, err = dec.filterRule(raw)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidBinary, err)
+			}
+		case binaryHostsRule:
+			rule = newHostsRule(dec.string(), raw)
+		default:
+			return ErrInvalidBinary
+		}
+		rule.Source = sources[source]
+		rule.Line = line
+		dec.rules[i] = rule
+	}
+
+	decoded := CreateRuleSet()
+	for i, count := 0, dec.count(); i < count; i++ {
+		decoded.badFilters[dec.string()] = struct{}{}
+	}
+	for _, m := range decoded.matchers() {
+		dec.pathMatcher(m, m.addressPartMatcher)
+		dec.pathMatcher(m, m.domainNameMatcher)
+		dec.pathMatcher(m, m.exactAddressMatcher)
+		m.regexpRules = dec.ruleRefs(m)
+	}
+	for i, count := 0, dec.count(); i < count; i++ {
+		raw, source, line := dec.string(), dec.uint(), dec.uint()
+		if dec.err != nil {
+			return dec.err
+		}
+		if source >= len(sources) {
+			return ErrInvalidBinary
+		}
+		rule, err := ParseCosmeticRule(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBinary, err)
+		}
+		rule.Source = sources[source]
+		rule.Line = line
+		decoded.AddCosmeticRule(rule)
+	}
+	for i, count := 0, dec.count(); i < count; i++ {
+		raw, source, line := dec.string(), dec.uint(), dec.uint()
+		if dec.err != nil {
+			return dec.err
+		}
+		if source >= len(sources) {
+			return ErrInvalidBinary
+		}
+		rule, err := ParseScriptletRule(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBinary, err)
+		}
+		rule.Source = sources[source]
+		rule.Line = line
+		decoded.AddScriptletRule(rule)
+	}
+	if dec.err != nil {
+		return dec.err
+	}
+	if len(dec.data) != 0 {
+		return ErrInvalidBinary
+	}
+	*ruleSet = *decoded
+	return nil
+}
+
+type encoder struct {
+	buf        bytes.Buffer
+	scratch    [binary.MaxVarintLen64]byte
+	rules      map[*RuleAdBlock]int
+	ruleList   []*RuleAdBlock
+	sources    map[string]int
+	sourceList []string
+}
+
+// collect numbers every rule of the matcher
+func (enc *encoder) collect(m *matcher) {
+	keys := make([]string, 0, len(m.index))
+	for key := range m.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, rule := range m.index[key] {
+			if _, ok := enc.rules[rule]; ok {
+				continue
+			}
+			enc.rules[rule] = len(enc.ruleList)
+			enc.ruleList = append(enc.ruleList, rule)
+			enc.source(rule.Source)
+		}
+	}
+}
+
+// source numbers the list name
+func (enc *encoder) source(source string) {
+	if _, ok := enc.sources[source]; !ok {
+		enc.sources[source] = len(enc.sourceList)
+		enc.sourceList = append(enc.sourceList, source)
+	}
+}
+
+func (enc *encoder) uint(value int) {
+	n := binary.PutUvarint(enc.scratch[:], uint64(value))
+	enc.buf.Write(enc.scratch[:n])
+}
+
+func (enc *encoder) string(value string) {
+	enc.uint(len(value))
+	enc.buf.WriteString(value)
+}
+
+func (enc *encoder) int(value int) {
+	n := binary.PutVarint(enc.scratch[:], int64(value))
+	enc.buf.Write(enc.scratch[:n])
+}
+
+func (enc *encoder) bools(values map[string]bool) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	enc.uint(len(keys))
+	for _, key := range keys {
+		enc.string(key)
+		if values[key] {
+			enc.uint(1)
+		} else {
+			enc.uint(0)
+		}
+	}
+}
+
+// filterRule writes the fields ParseRule sets, so that loading doesn't parse the rule again
+func (enc *encoder) filterRule(rule *RuleAdBlock) {
+	flags := 0
+	if rule.IsException {
+		flags |= binaryException
+	}
+	if rule.Important {
+		flags |= binaryImportant
+	}
+	if rule.RedirectRule {
+		flags |= binaryRedirectRule
+	}
+	if rule.RemoveParam {
+		flags |= binaryRemoveParam
+	}
+	if rule.CSP {
+		flags |= binaryCSP
+	}
+	enc.string(rule.RuleText)
+	enc.string(rule.regexSource)
+	enc.uint(int(rule.RuleType))
+	enc.uint(flags)
+	enc.uint(int(rule.Types))
+	enc.uint(int(rule.ExcludedTypes))
+	enc.bools(rule.Options)
+	enc.bools(rule.Domains)
+	enc.bools(rule.Clients)
+	enc.string(rule.Redirect)
+	enc.int(rule.RedirectPriority)
+	enc.string(rule.RemoveParamPattern)
+	enc.string(rule.CSPPolicy)
+}
+
+func (enc *encoder) ruleRefs(rules []*RuleAdBlock) {
+	enc.uint(len(rules))
+	for _, rule := range rules {
+		enc.uint(enc.rules[rule])
+	}
+}
+
+// pathMatcher writes the node rules and its children sorted by rune
+func (enc *encoder) pathMatcher(pm *pathMatcher) {
+	enc.ruleRefs(pm.rules)
+	runes := make([]rune, 0, len(pm.next))
+	for r := range pm.next {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	enc.uint(len(runes))
+	for _, r := range runes {
+		enc.uint(int(r))
+		enc.pathMatcher(pm.next[r])
+	}
+}
+
+type decoder struct {
+	data  []byte
+	rules []*RuleAdBlock
+	err   error
+}
+
+func (dec *decoder) uint() int {
+	if dec.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(dec.data)
+	if n <= 0 || value > math.MaxInt32 {
+		dec.err = ErrInvalidBinary
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return int(value)
+}
+
+func (dec *decoder) int() int {
+	if dec.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(dec.data)
+	if n <= 0 || value > math.MaxInt32 || value < math.MinInt32 {
+		dec.err = ErrInvalidBinary
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return int(value)
+}
+
+func (dec *decoder) bools() map[string]bool {
+	values := map[string]bool{}
+	for i, count := 0, dec.count(); i < count && dec.err == nil; i++ {
+		key := dec.string()
+		values[key] = dec.uint() == 1
+	}
+	return values
+}
+
+// filterRule reads the fields written by encoder.filterRule
+func (dec *decoder) filterRule(raw string) (*RuleAdBlock, error) {
+	rule := &RuleAdBlock{
+		Raw:         raw,
+		RuleText:    dec.string(),
+		regexSource: dec.string(),
+		RuleType:    RuleType(dec.uint()),
+	}
+	flags := dec.uint()
+	rule.IsException = flags&binaryException != 0
+	rule.Important = flags&binaryImportant != 0
+	rule.RedirectRule = flags&binaryRedirectRule != 0
+	rule.CSP = flags&binaryCSP != 0
+	rule.Types = ResourceTypeMask(dec.uint())
+	rule.ExcludedTypes = ResourceTypeMask(dec.uint())
+	rule.Options = dec.bools()
+	rule.Domains = dec.bools()
+	if clients := dec.bools(); len(clients) > 0 {
+		rule.Clients = clients
+	}
+	rule.Redirect = dec.string()
+	rule.RedirectPriority = dec.int()
+	removeParamPattern := dec.string()
+	rule.CSPPolicy = dec.string()
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if flags&binaryRemoveParam != 0 {
+		if err := parseRemoveParam(rule, removeParamPattern); err != nil {
+			return nil, err
+		}
+	}
+	return rule, nil
+}
+
+// count reads a number of entries, which can't be more than the bytes left
+func (dec *decoder) count() int {
+	count := dec.uint()
+	if count > len(dec.data) {
+		dec.err = ErrInvalidBinary
+		return 0
+	}
+	return count
+}
+
+func (dec *decoder) string() string {
+	length := dec.count()
+	if dec.err != nil {
+		return ""
+	}
+	value := string(dec.data[:length])
+	dec.data = dec.data[length:]
+	return value
+}
+
+func (dec *decoder) ruleRefs(m *matcher) []*RuleAdBlock {
+	count := dec.count()
+	if count == 0 {
+		return nil
+	}
+	rules := make([]*RuleAdBlock, 0, count)
+	for i := 0; i < count; i++ {
+		index := dec.uint()
+		if dec.err != nil {
+			return nil
+		}
+		if index >= len(dec.rules) {
+			dec.err = ErrInvalidBinary
+			return nil
+		}
+		rule := dec.rules[index]
+		key := rule.filterKey()
+		m.index[key] = append(m.index[key], rule)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (dec *decoder) pathMatcher(m *matcher, pm *pathMatcher) {
+	pm.rules = dec.ruleRefs(m)
+	for i, count := 0, dec.count(); i < count && dec.err == nil; i++ {
+		r := rune(dec.uint())
+		next := &pathMatcher{
+			next: map[rune]*pathMatcher{},
+		}
+		pm.next[r] = next
+		dec.pathMatcher(m, next)
+	}
+}
@@ -0,0 +1,135 @@
+package adblockgoparser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleSetBinaryRoundTrip(t *testing.T) {
+	list := strings.Join([]string{
+		"/banner/*/img^",
+		"||ads.example.com^",
+		"|http://example.com/|",
+		"/ads\\d+/",
+		"||tracker.example.com^$important,third-party",
+		"@@||ads.example.com^$script",
+		"||cdn.example.com^$badfilter",
+		"example.com,~sub.example.com##.ad",
+		"sub.example.com#@#.banner",
+		"##.banner",
+		"example.com##+js(set-constant, ads, true)",
+		"$removeparam=/^utm_/",
+		"||scripts.example.net^$script,redirect=noopjs",
+	}, "\n")
+	ruleSet := CreateRuleSet()
+	_, err := ruleSet.AddList("easylist", strings.NewReader(list))
+	assert.NoError(t, err)
+
+	data, err := ruleSet.MarshalBinary()
+	assert.NoError(t, err)
+	again, err := ruleSet.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	loaded := &RuleSet{}
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+
+	for _, rawURL := range []string{
+		"http://example.com/banner/foo/img",
+		"http://example.com/banner/img",
+		"http://ads.example.com/foo.gif",
+		"http://ads.example.com/file.js",
+		"http://example.com/",
+		"http://example.com/ads12",
+		"http://tracker.example.com/",
+		"http://other.com/",
+	} {
+		assert.Equal(t, ruleSet.Allow(reqFromURL(rawURL)), loaded.Allow(reqFromURL(rawURL)), rawURL)
+	}
+
+	assert.Equal(t, ruleSet.CosmeticSelectors("www.example.com"), loaded.CosmeticSelectors("www.example.com"))
+	assert.Equal(t, []string{".banner"}, loaded.CosmeticSelectors("other.com"))
+	assert.Empty(t, loaded.CosmeticSelectors("sub.example.com"))
+	assert.Equal(t, ruleSet.Scriptlets("example.com"), loaded.Scriptlets("example.com"))
+	assert.Equal(t, "http://example.com/?id=1", loaded.RemoveParams(reqFromURL("http://example.com/?utm_source=a&id=1")).String())
+	assert.Equal(t, "noopjs", loaded.Match(reqFromURL("http://scripts.example.net/ad.js")).Redirect)
+
+	result := loaded.Match(reqFromURL("http://ads.example.com/foo.gif"))
+	assert.Equal(t, "easylist", result.Source)
+	assert.Equal(t, 2, result.Rule.Line)
+
+	// Badfilters still apply to rules added after loading
+	rule, err := ParseRule("||cdn.example.com^")
+	assert.NoError(t, err)
+	loaded.AddRule(rule)
+	assert.True(t, loaded.Allow(reqFromURL("http://cdn.example.com/")))
+}
+
+func TestRuleSetUnmarshalInvalid(t *testing.T) {
+	ruleSet := &RuleSet{}
+	assert.True(t, errors.Is(ruleSet.UnmarshalBinary([]byte("nope")), ErrInvalidBinary))
+	assert.True(t, errors.Is(ruleSet.UnmarshalBinary([]byte("ABGP\x7f")), ErrBinaryVersion))
+
+	data, err := CreateRuleSet().MarshalBinary()
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(ruleSet.UnmarshalBinary(data[:len(data)-1]), ErrInvalidBinary))
+}
+
+func TestRuleSetBinaryKeepsParsedFields(t *testing.T) {
+	list := strings.Join([]string{
+		"@@||ads.example.com^$script,~image,domain=news.com|~sport.news.com",
+		"||tracker.example.com^$important,third-party,match-case",
+		"||ads.example.com^$redirect=noopjs:-5",
+		"||dns.example.com^$client=10.0.0.0/8|~10.0.0.1",
+		"$removeparam=~/^id$/i",
+		"@@||example.com^$csp=script-src 'self'",
+		"@@||trusted.com^$document",
+	}, "\n")
+	ruleSet := CreateRuleSet()
+	_, err := ruleSet.AddList("easylist", strings.NewReader(list))
+	assert.NoError(t, err)
+	data, err := ruleSet.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := &RuleSet{}
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+
+	loadedRules := map[string]*RuleAdBlock{}
+	for _, m := range loaded.matchers() {
+		for _, rules := range m.index {
+			for _, rule := range rules {
+				loadedRules[rule.Raw] = rule
+			}
+		}
+	}
+	assert.Len(t, loadedRules, 7)
+	for _, raw := range strings.Split(list, "\n") {
+		parsed, err := ParseRule(raw)
+		assert.NoError(t, err)
+		rule := loadedRules[raw]
+		if !assert.NotNil(t, rule, raw) {
+			continue
+		}
+		assert.Nil(t, rule.Regex, raw)
+		assert.Equal(t, parsed.RuleText, rule.RuleText, raw)
+		assert.Equal(t, parsed.regexSource, rule.regexSource, raw)
+		assert.Equal(t, parsed.RuleType, rule.RuleType, raw)
+		assert.Equal(t, parsed.IsException, rule.IsException, raw)
+		assert.Equal(t, parsed.Important, rule.Important, raw)
+		assert.Equal(t, parsed.Types, rule.Types, raw)
+		assert.Equal(t, parsed.ExcludedTypes, rule.ExcludedTypes, raw)
+		assert.Equal(t, parsed.Options, rule.Options, raw)
+		assert.Equal(t, parsed.Domains, rule.Domains, raw)
+		assert.Equal(t, parsed.Clients, rule.Clients, raw)
+		assert.Equal(t, parsed.Redirect, rule.Redirect, raw)
+		assert.Equal(t, parsed.RedirectRule, rule.RedirectRule, raw)
+		assert.Equal(t, parsed.RedirectPriority, rule.RedirectPriority, raw)
+		assert.Equal(t, parsed.RemoveParam, rule.RemoveParam, raw)
+		assert.Equal(t, parsed.RemoveParamPattern, rule.RemoveParamPattern, raw)
+		assert.Equal(t, parsed.removeParamRegex, rule.removeParamRegex, raw)
+		assert.Equal(t, parsed.CSP, rule.CSP, raw)
+		assert.Equal(t, parsed.CSPPolicy, rule.CSPPolicy, raw)
+	}
+}